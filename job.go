@@ -0,0 +1,432 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"pdf-processor/internal/chunker"
+	"pdf-processor/internal/combiner"
+	"pdf-processor/internal/config"
+	"pdf-processor/internal/langdetect"
+	"pdf-processor/internal/pdf"
+	"pdf-processor/internal/prompts"
+	"pdf-processor/internal/readability"
+	"pdf-processor/internal/utils"
+	"pdf-processor/internal/workers"
+	"strconv"
+	"strings"
+)
+
+// job holds the request parameters shared by /process and /v1/chunks.
+type job struct {
+	text             string
+	document         *pdf.Document
+	title            string
+	uploadName       string
+	pageSelection    string
+	sectionSelection string
+	streaming        bool
+	body             *bufio.Reader
+	markdown         bool
+	ratio            float64
+	mode             combiner.Mode
+	template         *prompts.Template
+	readingLevel     *readability.Level
+	sourceLanguage   langdetect.Result
+	targetLanguage   langdetect.Language
+	split            string
+	chapters         []chunker.Chapter
+	abbreviations    []string
+}
+
+// requestError is a request problem reported to the client. Code, if set,
+// names the problem for clients to act on and is sent in the X-Error-Code
+// header.
+type requestError struct {
+	status  int
+	code    string
+	message string
+}
+
+func (e *requestError) Error() string {
+	return e.message
+}
+
+func badRequest(message string) *requestError {
+	return &requestError{status: http.StatusBadRequest, message: message}
+}
+
+func (e *requestError) write(w http.ResponseWriter) {
+	if e.code != "" {
+		w.Header().Set("X-Error-Code", e.code)
+	}
+	http.Error(w, e.message, e.status)
+}
+
+// parseJob reads and validates the job parameters and detects the chapters
+// of the text. A text/plain or text/markdown body takes its other parameters
+// from the query string. Within the upload limit it is read in full and used
+// as the text, so that it is split into chapters like a text field; a larger
+// body is streamed as a single chapter if stream is set, and refused
+// otherwise. Only the start of a streamed body is kept, to detect the
+// language. A multipart form may carry a PDF in the file field instead of
+// the text field; its text is extracted on the server.
+func parseJob(r *http.Request, cfg *config.Config, templates *prompts.Registry, stream bool) (*job, *requestError) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	plainBody := mediaType == "text/plain" || mediaType == "text/markdown"
+	j := &job{markdown: mediaType == "text/markdown"}
+
+	if !plainBody {
+		r.Body = http.MaxBytesReader(nil, r.Body, cfg.MaxUploadBytes)
+	}
+	if mediaType == "multipart/form-data" {
+		if err := r.ParseMultipartForm(32 << 20); err != nil {
+			log.Printf("Error: failed to parse multipart form: %v", err)
+			return nil, uploadError(err)
+		}
+	}
+
+	if markdownStr := r.FormValue("markdown"); markdownStr != "" {
+		var err error
+		j.markdown, err = strconv.ParseBool(markdownStr)
+		if err != nil {
+			log.Printf("Error: invalid markdown value %q", markdownStr)
+			return nil, badRequest("Invalid markdown value")
+		}
+	}
+
+	j.text = r.FormValue("text")
+	switch {
+	case plainBody:
+		body, err := io.ReadAll(io.LimitReader(r.Body, cfg.MaxUploadBytes+1))
+		if err != nil {
+			log.Printf("Error: failed to read request body: %v", err)
+			return nil, uploadError(err)
+		}
+		if int64(len(body)) <= cfg.MaxUploadBytes {
+			j.text = strings.ToValidUTF8(string(body), "")
+			break
+		}
+		if !stream {
+			log.Printf("Error: request body exceeds %d bytes", cfg.MaxUploadBytes)
+			return nil, uploadError(&http.MaxBytesError{Limit: cfg.MaxUploadBytes})
+		}
+		log.Printf("Request body exceeds %d bytes, streaming it", cfg.MaxUploadBytes)
+		j.streaming = true
+		j.body = bufio.NewReaderSize(io.MultiReader(bytes.NewReader(body), r.Body), languageSampleBytes)
+		sample, _ := j.body.Peek(languageSampleBytes)
+		j.text = strings.ToValidUTF8(string(sample), "")
+	case j.hasFile(r):
+		if j.text != "" {
+			log.Printf("Error: request has both a text field and a file")
+			return nil, badRequest("Send either a text field or a file, not both")
+		}
+		doc, reqErr := extractPDF(r)
+		if reqErr != nil {
+			return nil, reqErr
+		}
+		j.document, j.text = doc, doc.Text
+		j.title = doc.Info.Title
+		j.uploadName = path.Base(r.MultipartForm.File["file"][0].Filename)
+		j.pageSelection, j.sectionSelection = r.FormValue("pages"), r.FormValue("sections")
+	}
+	if !j.hasFile(r) && (r.FormValue("pages") != "" || r.FormValue("sections") != "") {
+		log.Printf("Error: page selection requested without a PDF")
+		return nil, badRequest("Pages and sections can only be selected in PDF uploads")
+	}
+	if !j.hasFile(r) && r.FormValue("password") != "" {
+		log.Printf("Error: password sent without a PDF")
+		return nil, badRequest("A password can only be sent with a PDF upload")
+	}
+	if j.text == "" {
+		log.Printf("Error: text field is missing in request")
+		return nil, badRequest("Text field is missing")
+	}
+
+	ratioStr := r.FormValue("ratio")
+	if ratioStr == "" {
+		log.Printf("Error: ratio field is missing in request")
+		return nil, badRequest("Ratio field is missing")
+	}
+
+	var err error
+	j.ratio, err = strconv.ParseFloat(ratioStr, 64)
+	if err != nil || j.ratio <= 0 || j.ratio > 1 {
+		log.Printf("Error: invalid ratio value: %v", err)
+		return nil, badRequest("Invalid ratio value")
+	}
+
+	j.mode, err = combiner.ParseMode(r.FormValue("mode"))
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return nil, badRequest("Invalid output mode")
+	}
+	log.Printf("Using output mode %s", j.mode)
+
+	templateName := r.FormValue("template")
+	if templateName == "" {
+		templateName = j.mode.Template()
+	}
+	j.template, err = templates.Get(templateName)
+	if err != nil {
+		log.Printf("Error: invalid prompt template: %v", err)
+		return nil, badRequest("Invalid prompt template")
+	}
+	if !j.mode.Fits(j.template.Mode) {
+		log.Printf("Error: prompt template %s (mode %q) does not fit output mode %s", j.template.ID(), j.template.Mode, j.mode)
+		return nil, badRequest(fmt.Sprintf("Prompt template %s cannot be used with output mode %s", j.template.Name, j.mode))
+	}
+	log.Printf("Using prompt template %s", j.template.ID())
+
+	j.readingLevel, err = readability.ParseLevel(r.FormValue("reading_level"))
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return nil, badRequest("Invalid reading level")
+	}
+	if j.readingLevel != nil {
+		log.Printf("Using reading level %s (target grade %g)", j.readingLevel.Label, j.readingLevel.Grade)
+	}
+
+	if j.streaming {
+		log.Printf("Streaming text body, detecting language from the first %d bytes", len(j.text))
+	} else {
+		log.Printf("Received text, content length: %d words", chunker.WordCount(j.text))
+	}
+
+	j.sourceLanguage = langdetect.Detect(j.text)
+	j.targetLanguage = j.sourceLanguage.Language
+	if target := r.FormValue("target_language"); target != "" {
+		j.targetLanguage, err = langdetect.Lookup(target)
+		if err != nil {
+			log.Printf("Error: %v", err)
+			return nil, badRequest("Unsupported target language")
+		}
+	}
+	log.Printf("Source language %s, target language %s", j.sourceLanguage.Code, j.targetLanguage.Code)
+
+	// A pinned older template version may not know about a parameter of the
+	// job and would silently ignore it.
+	needs := []struct {
+		field, parameter string
+		needed           bool
+	}{
+		{"OutputLanguage", "target_language", j.targetLanguage.Code != j.sourceLanguage.Code},
+		{"ReadingLevel", "reading_level", j.readingLevel != nil},
+		{"Placeholders", "markdown", j.markdown},
+		{"Context", "chunk overlap", cfg.ChunkOverlap > 0},
+	}
+	for _, need := range needs {
+		if need.needed && !j.template.Uses(need.field) {
+			log.Printf("Error: prompt template %s does not support %s", j.template.ID(), need.parameter)
+			return nil, badRequest(fmt.Sprintf("Prompt template %s does not support %s", j.template.ID(), need.parameter))
+		}
+	}
+
+	j.split = r.FormValue("split")
+	if j.split != "" && j.split != "chapters" {
+		log.Printf("Error: invalid split value %q", j.split)
+		return nil, badRequest("Invalid split value")
+	}
+
+	if j.streaming && (r.FormValue("chapter") != "" || j.split != "") {
+		log.Printf("Error: chapter selection requested for a streamed body")
+		return nil, badRequest("Chapters are not available for streamed text")
+	}
+
+	// A streamed body is processed as a single untitled chapter.
+	j.chapters = []chunker.Chapter{{Index: 0}}
+	if !j.streaming {
+		var outline []string
+		if j.document != nil {
+			outline = j.document.ChapterTitles()
+			log.Printf("Seeding chapter detection with %d outline titles", len(outline))
+		}
+		j.chapters = chunker.DetectChapters(j.text, outline, j.markdown)
+	}
+	if chapterStr := r.FormValue("chapter"); chapterStr != "" {
+		chapter, err := strconv.Atoi(chapterStr)
+		if err != nil || chapter < 1 || chapter > len(j.chapters) {
+			log.Printf("Error: invalid chapter %q, document has %d chapters", chapterStr, len(j.chapters))
+			return nil, badRequest("Invalid chapter")
+		}
+		j.chapters = j.chapters[chapter-1 : chapter]
+		log.Printf("Processing only chapter %d %q", chapter, j.chapters[0].Title)
+	}
+
+	if extra := r.FormValue("abbreviations"); extra != "" {
+		j.abbreviations = strings.Split(extra, ",")
+		log.Printf("Using %d extra abbreviations", len(j.abbreviations))
+	}
+	return j, nil
+}
+
+// uploadError reports a request body that could not be read, telling the
+// client when it was over the size limit.
+func uploadError(err error) *requestError {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return &requestError{status: http.StatusRequestEntityTooLarge, message: fmt.Sprintf("Upload exceeds %d MB", tooLarge.Limit>>20)}
+	}
+	return badRequest("Failed to read upload")
+}
+
+func (j *job) hasFile(r *http.Request) bool {
+	return r.MultipartForm != nil && len(r.MultipartForm.File["file"]) > 0
+}
+
+// extractPDF extracts the text of the PDF uploaded in the file field,
+// limited to the pages and outline sections selected by the pages and
+// sections fields ("12-80,95"). An encrypted PDF is opened with the
+// password field; a missing or wrong password is reported with its own
+// status and error code.
+func extractPDF(r *http.Request) (*pdf.Document, *requestError) {
+	var sel pdf.Selection
+	for _, field := range []string{"pages", "sections"} {
+		value := r.FormValue(field)
+		if value == "" {
+			continue
+		}
+		spans, err := pdf.ParseSpans(value)
+		if err != nil {
+			log.Printf("Error: invalid %s value: %v", field, err)
+			return nil, badRequest("Invalid " + field + " value")
+		}
+		if field == "pages" {
+			sel.Pages = spans
+		} else {
+			sel.Sections = spans
+		}
+		log.Printf("Selecting %s %s", field, value)
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		log.Printf("Error: failed to open uploaded file: %v", err)
+		return nil, badRequest("Failed to read upload")
+	}
+	defer file.Close()
+	log.Printf("Received PDF upload %q (%d bytes)", header.Filename, header.Size)
+
+	if err := utils.ValidatePDF(file); err != nil {
+		log.Printf("Error: invalid PDF upload %q: %v", header.Filename, err)
+		return nil, &requestError{status: http.StatusUnsupportedMediaType, message: "Uploaded file is not a PDF"}
+	}
+
+	doc, err := pdf.Extract(file, &sel, r.FormValue("password"))
+	switch {
+	case errors.Is(err, pdf.ErrInvalidSelection):
+		return nil, badRequest(strings.ToUpper(err.Error()[:1]) + err.Error()[1:])
+	case errors.Is(err, pdf.ErrPasswordRequired):
+		log.Printf("Error: PDF %q is encrypted and no password was sent", header.Filename)
+		return nil, &requestError{status: http.StatusUnauthorized, code: "pdf_password_required", message: "PDF is password-protected; send its password in the password field"}
+	case errors.Is(err, pdf.ErrWrongPassword):
+		log.Printf("Error: wrong password for PDF %q", header.Filename)
+		return nil, &requestError{status: http.StatusForbidden, code: "pdf_password_incorrect", message: "Incorrect PDF password"}
+	case errors.Is(err, pdf.ErrUnsupportedEncryption):
+		log.Printf("Error: %v", err)
+		return nil, &requestError{status: http.StatusUnprocessableEntity, code: "pdf_encryption_unsupported", message: "PDF uses an unsupported kind of encryption"}
+	}
+	if err != nil {
+		log.Printf("Error: %v", utils.WrapError("extract", "failed to extract PDF text", err))
+		return nil, &requestError{status: http.StatusUnprocessableEntity, message: "Failed to extract text from PDF"}
+	}
+	if strings.TrimSpace(doc.Text) == "" {
+		log.Printf("Error: PDF %q has no extractable text", header.Filename)
+		return nil, &requestError{status: http.StatusUnprocessableEntity, message: "PDF has no extractable text"}
+	}
+	return doc, nil
+}
+
+func (j *job) workerOptions() workers.Options {
+	return workers.Options{
+		Ratio:          j.ratio,
+		Template:       j.template,
+		ReadingLevel:   j.readingLevel,
+		SourceLanguage: j.sourceLanguage.Language,
+		TargetLanguage: j.targetLanguage,
+		Markdown:       j.markdown,
+	}
+}
+
+// chunkOptions returns the chunker options for the job, with the token
+// budget left by its prompt.
+func (j *job) chunkOptions(cfg *config.Config, abbreviations *chunker.AbbreviationPacks, strategy chunker.Strategy) (chunker.Options, error) {
+	chunkTokens, err := workers.ChunkTokens(cfg, j.workerOptions())
+	if err != nil {
+		return chunker.Options{}, err
+	}
+	return chunker.Options{
+		ChunkSize:     cfg.ChunkSize,
+		ChunkTokens:   chunkTokens,
+		Strategy:      strategy,
+		Overlap:       cfg.ChunkOverlap,
+		Markdown:      j.markdown,
+		Abbreviations: abbreviations.For(j.sourceLanguage.Code, j.abbreviations),
+	}, nil
+}
+
+// pages returns the PDF pages covering a character range of the text, or
+// nil if the text did not come from a PDF.
+func (j *job) pages(start, end int) *pageRange {
+	if j.document == nil {
+		return nil
+	}
+	first, last, ok := j.document.PageRange(start, end)
+	if !ok {
+		return nil
+	}
+	return &pageRange{First: first, Last: last}
+}
+
+// filename names an output file after the document, as in
+// "annual-report-notes.md" for "notes.md", using the PDF's title or else the
+// name it was uploaded under. The prose output is named after the document
+// alone. Text uploads keep the plain name.
+func (j *job) filename(name string) string {
+	base := utils.Slug(j.title)
+	if base == "" {
+		base = utils.Slug(strings.TrimSuffix(j.uploadName, path.Ext(j.uploadName)))
+	}
+	if base == "" {
+		return name
+	}
+	ext := path.Ext(name)
+	if strings.TrimSuffix(name, ext) == "processed" {
+		return base + ext
+	}
+	return base + "-" + name
+}
+
+func (j *job) metadata() jobMetadata {
+	meta := jobMetadata{
+		Title:          j.title,
+		Mode:           j.mode,
+		Template:       j.template.ID(),
+		SourceLanguage: j.sourceLanguage,
+		TargetLanguage: j.targetLanguage,
+	}
+	if j.readingLevel != nil {
+		meta.ReadingLevel = j.readingLevel.Label
+	}
+	if j.document != nil {
+		meta.Document = &documentMetadata{
+			Pages:          j.document.NumPages,
+			ExtractedPages: len(j.document.Pages),
+			PageSelection:  j.pageSelection,
+			Sections:       j.sectionSelection,
+			Author:         j.document.Info.Author,
+			Subject:        j.document.Info.Subject,
+			Removed:        []removedLines{},
+		}
+		for _, f := range j.document.Removed {
+			meta.Document.Removed = append(meta.Document.Removed, removedLines{Kind: f.Kind, Text: f.Text, Pages: f.Pages})
+		}
+	}
+	return meta
+}
@@ -7,24 +7,49 @@ import (
 	"log"
 	"net/http"
 	"pdf-processor/internal/chunker"
+	"pdf-processor/internal/combiner"
 	"pdf-processor/internal/config"
+	"pdf-processor/internal/pdf"
+	"pdf-processor/internal/prompts"
+	"pdf-processor/internal/readability"
 	"pdf-processor/internal/workers"
 	"strconv"
 	"strings"
 	"time"
 )
 
+// languageSampleBytes is how much of a streamed body is read ahead to
+// detect its language before chunking starts.
+const languageSampleBytes = 64 * 1024
+
 // enableCors adds the necessary CORS headers to allow cross-origin requests
 func enableCors(w *http.ResponseWriter) {
 	(*w).Header().Set("Access-Control-Allow-Origin", "*") // Allow any origin for development
 	(*w).Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS")
-	(*w).Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	(*w).Header().Set("Access-Control-Allow-Headers", "Content-Type, Accept")
+	(*w).Header().Set("Access-Control-Expose-Headers", "Content-Disposition, X-Error-Code, X-Prompt-Template, X-Output-Mode, X-Source-Language, X-Source-Language-Confidence, X-Target-Language, X-Reading-Level, X-Readability-Input-Grade, X-Readability-Input-Ease, X-Readability-Output-Grade, X-Readability-Output-Ease")
 }
 
 func main() {
 	log.Println("Starting PDF processor service")
 	cfg := config.Load()
-	log.Printf("Configuration loaded: Port=%s, MaxConcurrent=%d, ChunkSize=%d", cfg.Port, cfg.MaxConcurrent, cfg.ChunkSize)
+	log.Printf("Configuration loaded: Port=%s, Model=%s, MaxConcurrent=%d, ChunkSize=%d, ChunkTokens=%d",
+		cfg.Port, cfg.Model, cfg.MaxConcurrent, cfg.ChunkSize, cfg.ChunkTokens)
+
+	templates, err := prompts.Load(cfg.PromptDir)
+	if err != nil {
+		log.Fatalf("Failed to load prompt templates: %v", err)
+	}
+
+	abbreviations, err := chunker.LoadAbbreviations(cfg.AbbreviationsDir)
+	if err != nil {
+		log.Fatalf("Failed to load abbreviation packs: %v", err)
+	}
+
+	strategy, err := chunker.ParseStrategy(cfg.ChunkStrategy)
+	if err != nil {
+		log.Fatalf("Invalid chunk strategy: %v", err)
+	}
 
 	// Handle both OPTIONS preflight and actual processing
 	http.HandleFunc("/process", func(w http.ResponseWriter, r *http.Request) {
@@ -38,14 +63,27 @@ func main() {
 		}
 
 		// For other methods, proceed with normal processing
-		uploadHandler(cfg)(w, r)
+		uploadHandler(cfg, templates, abbreviations, strategy)(w, r)
+	})
+
+	http.HandleFunc("/v1/chunks", func(w http.ResponseWriter, r *http.Request) {
+		enableCors(&w)
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		chunksHandler(cfg, templates, abbreviations, strategy)(w, r)
 	})
 
 	log.Printf("Server starting on :%s", cfg.Port)
 	log.Fatal(http.ListenAndServe(":"+cfg.Port, nil))
 }
 
-func uploadHandler(cfg *config.Config) http.HandlerFunc {
+func uploadHandler(cfg *config.Config, templates *prompts.Registry, abbreviations *chunker.AbbreviationPacks, strategy chunker.Strategy) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		startTime := time.Now()
 		log.Printf("Received upload request from %s", r.RemoteAddr)
@@ -53,79 +91,192 @@ func uploadHandler(cfg *config.Config) http.HandlerFunc {
 		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Minute)
 		defer cancel()
 
-		text := r.FormValue("text")
-		if text == "" {
-			log.Printf("Error: text field is missing in request")
-			http.Error(w, "Text field is missing", http.StatusBadRequest)
+		j, reqErr := parseJob(r, cfg, templates, true)
+		if reqErr != nil {
+			reqErr.write(w)
 			return
 		}
+		chapters := j.chapters
 
-		ratioStr := r.FormValue("ratio")
-		if ratioStr == "" {
-			log.Printf("Error: ratio field is missing in request")
-			http.Error(w, "Ratio field is missing", http.StatusBadRequest)
-			return
+		var selected strings.Builder
+		for _, chapter := range chapters {
+			selected.WriteString(chapter.Text)
+			selected.WriteString("\n\n")
 		}
+		inputText := selected.String()
+		inputWordCount := chunker.WordCount(inputText)
 
-		ratio, err := strconv.ParseFloat(ratioStr, 64)
-		if err != nil || ratio <= 0 || ratio > 1 {
-			log.Printf("Error: invalid ratio value: %v", err)
-			http.Error(w, "Invalid ratio value", http.StatusBadRequest)
+		workerOpts := j.workerOptions()
+		chunkOpts, err := j.chunkOptions(cfg, abbreviations, strategy)
+		if err != nil {
+			log.Printf("Failed to compute chunk token budget: %v", err)
+			http.Error(w, "Prompt rendering failed", http.StatusInternalServerError)
 			return
 		}
 
-		inputWordCount := len(strings.Fields(text))
-		log.Printf("Received text, content length: %d words", inputWordCount)
+		var results []workers.Result
+		if j.streaming {
+			log.Printf("Streaming chunks with chunk size %d words, %d tokens", cfg.ChunkSize, chunkOpts.ChunkTokens)
+			results, err = workers.ProcessStream(ctx, chunker.StreamChunks(j.body, chunkOpts), cfg, workerOpts)
+			if err != nil {
+				log.Printf("Streaming text failed: %v", err)
+				http.Error(w, "Text chunking failed", http.StatusInternalServerError)
+				return
+			}
+		} else {
+			log.Printf("Chunking %d chapters with chunk size %d words, %d tokens (%s)", len(chapters), cfg.ChunkSize, chunkOpts.ChunkTokens, strategy)
+			chunks, err := chunker.ChunkChapters(chapters, chunkOpts)
+			if err != nil {
+				log.Printf("Text chunking failed: %v", err)
+				http.Error(w, "Text chunking failed", http.StatusInternalServerError)
+				return
+			}
+			log.Printf("Text successfully chunked into %d parts", len(chunks))
+			chunker.LocateChunks(j.text, chunks)
 
-		log.Printf("Chunking text with chunk size %d words", cfg.ChunkSize)
-		chunks, err := chunker.ChunkText(text, cfg.ChunkSize)
-		if err != nil {
-			log.Printf("Text chunking failed: %v", err)
-			http.Error(w, "Text chunking failed", http.StatusInternalServerError)
-			return
+			log.Printf("Starting processing of %d chunks with max concurrency %d", len(chunks), cfg.MaxConcurrent)
+			results = workers.ProcessChunks(ctx, chunks, cfg, workerOpts)
 		}
-		log.Printf("Text successfully chunked into %d parts", len(chunks))
-
-		log.Printf("Starting processing of %d chunks with max concurrency %d", len(chunks), cfg.MaxConcurrent)
-		results := workers.ProcessChunks(ctx, chunks, cfg, ratio)
 		if len(results) == 0 {
 			log.Printf("Processing failed: no results returned")
 			http.Error(w, "Processing failed", http.StatusInternalServerError)
 			return
 		}
-		log.Printf("Successfully processed %d/%d chunks", len(results), len(chunks))
+		log.Printf("Successfully processed %d chunks", len(results))
 
-		w.Header().Set("Content-Type", "text/plain")
-		w.Header().Set("Content-Disposition", "attachment; filename=processed.txt")
+		inputReadability := readability.Analyze(inputText)
+		if j.streaming {
+			chunkStats := make([]readability.Stats, len(results))
+			for i, res := range results {
+				inputWordCount += res.InputWords
+				chunkStats[i] = res.InputReadability
+			}
+			inputReadability = readability.Merge(chunkStats...)
+		}
 
-		combinedResult := combineResults(results)
-		outputWordCount := len(strings.Fields(combinedResult))
+		sections := chapterSections(chapters, results)
+		combinedResult := combiner.Combine(j.mode, sections, cfg.ChunkOverlap)
+		outputWordCount := chunker.WordCount(combinedResult)
 		reductionPercent := 100.0
 		if inputWordCount > 0 {
 			reductionPercent = 100.0 - (float64(outputWordCount)/float64(inputWordCount))*100.0
 		}
 
+		outputReadability := readability.Analyze(combinedResult)
+
+		w.Header().Set("Vary", "Accept")
+		w.Header().Set("X-Prompt-Template", j.template.ID())
+		w.Header().Set("X-Output-Mode", string(j.mode))
+		w.Header().Set("X-Source-Language", j.sourceLanguage.Code)
+		w.Header().Set("X-Source-Language-Confidence", strconv.FormatFloat(j.sourceLanguage.Confidence, 'f', 2, 64))
+		w.Header().Set("X-Target-Language", j.targetLanguage.Code)
+		w.Header().Set("X-Readability-Input-Grade", strconv.FormatFloat(inputReadability.FleschKincaidGrade, 'f', 1, 64))
+		w.Header().Set("X-Readability-Input-Ease", strconv.FormatFloat(inputReadability.FleschReadingEase, 'f', 1, 64))
+		w.Header().Set("X-Readability-Output-Grade", strconv.FormatFloat(outputReadability.FleschKincaidGrade, 'f', 1, 64))
+		w.Header().Set("X-Readability-Output-Ease", strconv.FormatFloat(outputReadability.FleschReadingEase, 'f', 1, 64))
+		if j.readingLevel != nil {
+			w.Header().Set("X-Reading-Level", j.readingLevel.Label)
+		}
+
 		log.Printf("Sending response, combined result size: %d words (reduced from %d words, %.1f%% reduction)",
 			outputWordCount, inputWordCount, reductionPercent)
+		log.Printf("Readability: input grade %.1f (ease %.1f), output grade %.1f (ease %.1f)",
+			inputReadability.FleschKincaidGrade, inputReadability.FleschReadingEase,
+			outputReadability.FleschKincaidGrade, outputReadability.FleschReadingEase)
+
+		combinedResult = combiner.AddTitle(j.mode, j.markdown, j.title, combinedResult)
+		if wantsJSON(r, j.mode) {
+			writeJSON(w, http.StatusOK, newProcessResponse(j.metadata(), cfg.ChunkOverlap, combinedResult, chapters, sections, results, j.text, j.pages, totalsResponse{
+				InputWords:       inputWordCount,
+				OutputWords:      outputWordCount,
+				ReductionPercent: reductionPercent,
+				DurationMS:       time.Since(startTime).Milliseconds(),
+				Readability:      readabilityPair{Input: inputReadability, Output: outputReadability},
+			}))
+			log.Printf("Request completed in %v", time.Since(startTime))
+			return
+		}
+
+		if j.split == "chapters" {
+			if err := writeChapterArchive(w, j.filename("chapters.zip"), j.mode, cfg.ChunkOverlap, chapters, sections); err != nil {
+				log.Printf("Failed to write chapter archive: %v", err)
+			}
+			log.Printf("Request completed in %v", time.Since(startTime))
+			return
+		}
+
+		contentType, filename := j.mode.ContentType(), j.filename(j.mode.Filename())
+		if j.markdown && j.mode == combiner.ModeProse {
+			contentType, filename = "text/markdown; charset=utf-8", j.filename("processed.md")
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", "attachment; filename="+filename)
 		io.WriteString(w, combinedResult)
 
 		log.Printf("Request completed in %v", time.Since(startTime))
 	}
 }
 
-func combineResults(results []string) string {
-	log.Printf("Combining %d result chunks", len(results))
-	var final strings.Builder
-	totalWords := 0
+// chunksHandler chunks the text exactly as /process would and returns the
+// chunks with their sizes and source offsets, without calling the model.
+func chunksHandler(cfg *config.Config, templates *prompts.Registry, abbreviations *chunker.AbbreviationPacks, strategy chunker.Strategy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		startTime := time.Now()
+		log.Printf("Received chunk preview request from %s", r.RemoteAddr)
 
-	for i, res := range results {
-		wordCount := len(strings.Fields(res))
-		totalWords += wordCount
-		log.Printf("Chunk %d: %d words", i+1, wordCount)
-		final.WriteString(res)
-		final.WriteString("\n\n")
+		// The preview keeps the whole text to locate the chunks in, so bodies
+		// over the upload limit, which /process would stream, are refused.
+		j, reqErr := parseJob(r, cfg, templates, false)
+		if reqErr != nil {
+			reqErr.write(w)
+			return
+		}
+
+		chunkOpts, err := j.chunkOptions(cfg, abbreviations, strategy)
+		if err != nil {
+			log.Printf("Failed to compute chunk token budget: %v", err)
+			http.Error(w, "Prompt rendering failed", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("Chunking %d chapters with chunk size %d words, %d tokens (%s)", len(j.chapters), cfg.ChunkSize, chunkOpts.ChunkTokens, strategy)
+		chunks, err := chunker.ChunkChapters(j.chapters, chunkOpts)
+		if err != nil {
+			log.Printf("Text chunking failed: %v", err)
+			http.Error(w, "Text chunking failed", http.StatusInternalServerError)
+			return
+		}
+		chunker.LocateChunks(j.text, chunks)
+
+		var outline []pdf.Section
+		if j.document != nil {
+			outline = j.document.Outline
+		}
+		writeJSON(w, http.StatusOK, newChunksResponse(j.metadata(), chunkOpts, outline, j.chapters, chunks, j.pages))
+		log.Printf("Chunk preview of %d chunks completed in %v", len(chunks), time.Since(startTime))
+	}
+}
+
+// chapterSections groups chunk results by chapter, in chapter order, for
+// the combiner. Failed chunks are left out.
+func chapterSections(chapters []chunker.Chapter, results []workers.Result) []combiner.Section {
+	sections := make([]combiner.Section, len(chapters))
+	position := make(map[int]int, len(chapters))
+	for i, chapter := range chapters {
+		sections[i].Title = chapter.Title
+		sections[i].Level = chapter.Level
+		position[chapter.Index] = i
 	}
 
-	log.Printf("Combined %d chunks into %d words total", len(results), totalWords)
-	return final.String()
+	for i, res := range results {
+		log.Printf("Chunk %d (chapter %d): %d words (template %s, model %s, finish reason %s, %d tokens, %d attempts, %v, grade %.1f -> %.1f)",
+			i+1, res.Chapter+1, res.OutputWords, res.Template, res.Model, res.FinishReason, res.Usage.TotalTokens, res.Attempts, res.Duration,
+			res.InputReadability.FleschKincaidGrade, res.OutputReadability.FleschKincaidGrade)
+		if res.Content == "" {
+			continue
+		}
+		idx := position[res.Chapter]
+		sections[idx].Parts = append(sections[idx].Parts, res.Content)
+	}
+	return sections
 }
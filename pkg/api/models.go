@@ -0,0 +1,36 @@
+package api
+
+import "log"
+
+// ModelInfo holds the token limits of a model.
+type ModelInfo struct {
+	Name            string
+	ContextWindow   int
+	MaxOutputTokens int
+}
+
+var models = map[string]ModelInfo{
+	"gemini-2.0-flash":      {Name: "gemini-2.0-flash", ContextWindow: 1048576, MaxOutputTokens: 8192},
+	"gemini-2.0-flash-lite": {Name: "gemini-2.0-flash-lite", ContextWindow: 1048576, MaxOutputTokens: 8192},
+	"gemini-1.5-flash":      {Name: "gemini-1.5-flash", ContextWindow: 1048576, MaxOutputTokens: 8192},
+	"gemini-1.5-flash-8b":   {Name: "gemini-1.5-flash-8b", ContextWindow: 1048576, MaxOutputTokens: 8192},
+	"gemini-1.5-pro":        {Name: "gemini-1.5-pro", ContextWindow: 2097152, MaxOutputTokens: 8192},
+	"gemini-2.5-flash":      {Name: "gemini-2.5-flash", ContextWindow: 1048576, MaxOutputTokens: 65536},
+	"gemini-2.5-pro":        {Name: "gemini-2.5-pro", ContextWindow: 1048576, MaxOutputTokens: 65536},
+}
+
+// conservativeLimits are used for models not in the table.
+var conservativeLimits = ModelInfo{ContextWindow: 32768, MaxOutputTokens: 8192}
+
+// LookupModel returns the limits of a model. Unknown models get conservative
+// limits so that chunks still fit.
+func LookupModel(name string) ModelInfo {
+	if info, ok := models[name]; ok {
+		return info
+	}
+	log.Printf("Warning: unknown model %s, assuming a %d token context window and %d output tokens",
+		name, conservativeLimits.ContextWindow, conservativeLimits.MaxOutputTokens)
+	info := conservativeLimits
+	info.Name = name
+	return info
+}
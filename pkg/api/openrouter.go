@@ -38,21 +38,29 @@ type GeminiResponse struct {
 	ModelVersion string `json:"modelVersion"`
 }
 
-func ProcessText(ctx context.Context, text, apiKey string, targetWordCount int) (string, error) {
-	startTime := time.Now()
-	inputWordCount := len(strings.Fields(text))
-	log.Printf("Processing text chunk of %d words (target: %d words)", inputWordCount, targetWordCount)
+type Usage struct {
+	PromptTokens int `json:"prompt_tokens"`
+	OutputTokens int `json:"output_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
 
-	prompt := fmt.Sprintf(`Condense this text to approximately %d words while:
-- Preserving all key plot points and essential information
-- Removing redundant descriptions and unnecessary elaborations
-- Using extremely simple English with basic vocabulary (like for a 10-year-old)
-- Using short, simple sentences without complex structures
-- Avoiding any advanced vocabulary, idioms, or complicated expressions
-- Maintaining the original narrative flow and storytelling style
-- Keeping the text engaging and interesting
+func (u *Usage) Add(other Usage) {
+	u.PromptTokens += other.PromptTokens
+	u.OutputTokens += other.OutputTokens
+	u.TotalTokens += other.TotalTokens
+}
+
+type Completion struct {
+	Text         string
+	Model        string
+	FinishReason string
+	Usage        Usage
+}
 
-Important: Return ONLY the condensed text without any introductions, explanations, or summaries. Do not include phrases like "Here's the condensed version" or "In summary". Just provide the rewritten text directly.`, targetWordCount)
+func ProcessText(ctx context.Context, model, text, prompt, apiKey string) (*Completion, error) {
+	startTime := time.Now()
+	inputWordCount := len(strings.Fields(text))
+	log.Printf("Processing text chunk of %d words", inputWordCount)
 
 	payload := map[string]any{
 		"contents": []map[string]any{
@@ -67,8 +75,8 @@ Important: Return ONLY the condensed text without any introductions, explanation
 	}
 
 	body, _ := json.Marshal(payload)
-	log.Printf("Preparing API request to Gemini API with model gemini-2.0-flash")
-	req, _ := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/gemini-2.0-flash:generateContent?key=%s", apiKey), bytes.NewReader(body))
+	log.Printf("Preparing API request to Gemini API with model %s", model)
+	req, _ := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/%s:generateContent?key=%s", model, apiKey), bytes.NewReader(body))
 
 	req.Header.Set("Content-Type", "application/json")
 
@@ -77,35 +85,49 @@ Important: Return ONLY the condensed text without any introductions, explanation
 	resp, err := client.Do(req)
 	if err != nil {
 		log.Printf("API request failed: %v", err)
-		return "", err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		log.Printf("API request returned non-OK status: %s", resp.Status)
-		return "", fmt.Errorf("API request failed: %s", resp.Status)
+		return nil, fmt.Errorf("API request failed: %s", resp.Status)
 	}
 	log.Printf("Received response from Gemini API with status %s", resp.Status)
 
 	var response GeminiResponse
 	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
 		log.Printf("Failed to decode API response: %v", err)
-		return "", err
+		return nil, err
 	}
 
 	if len(response.Candidates) == 0 || len(response.Candidates[0].Content.Parts) == 0 {
 		log.Printf("API response contained no content")
-		return "", fmt.Errorf("no content in response")
+		return nil, fmt.Errorf("no content in response")
+	}
+
+	candidate := response.Candidates[0]
+	result := &Completion{
+		Text:         candidate.Content.Parts[0].Text,
+		Model:        response.ModelVersion,
+		FinishReason: candidate.FinishReason,
+		Usage: Usage{
+			PromptTokens: response.UsageMetadata.PromptTokenCount,
+			OutputTokens: response.UsageMetadata.CandidatesTokenCount,
+			TotalTokens:  response.UsageMetadata.TotalTokenCount,
+		},
+	}
+	if result.Model == "" {
+		result.Model = model
 	}
 
-	result := response.Candidates[0].Content.Parts[0].Text
-	outputWordCount := len(strings.Fields(result))
+	outputWordCount := len(strings.Fields(result.Text))
 	reductionPercent := 100.0
 	if inputWordCount > 0 {
 		reductionPercent = 100.0 - (float64(outputWordCount)/float64(inputWordCount))*100.0
 	}
 
-	log.Printf("Successfully processed text in %v, result length: %d words (reduced from %d words, %.1f%% reduction)",
-		time.Since(startTime), outputWordCount, inputWordCount, reductionPercent)
+	log.Printf("Successfully processed text in %v, result length: %d words (reduced from %d words, %.1f%% reduction), finish reason %s, %d tokens",
+		time.Since(startTime), outputWordCount, inputWordCount, reductionPercent, result.FinishReason, result.Usage.TotalTokens)
 	return result, nil
 }
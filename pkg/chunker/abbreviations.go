@@ -0,0 +1,183 @@
+package chunker
+
+import (
+	"bufio"
+	"embed"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const defaultAbbreviationLanguage = "en"
+
+//go:embed abbreviations/*.txt
+var builtinAbbreviations embed.FS
+
+type abbreviation struct {
+	text  string
+	final bool
+}
+
+// Abbreviations is the set of abbreviations protected during sentence
+// segmentation, indexed by their last space-separated token.
+type Abbreviations struct {
+	byLastToken map[string][]abbreviation
+}
+
+// AbbreviationPacks holds one abbreviation list per language, read from
+// "<language>.txt" files. Each line holds an abbreviation, optionally
+// followed by "final" if it may also end a sentence; "#" starts a comment.
+type AbbreviationPacks struct {
+	packs map[string][]abbreviation
+}
+
+// LoadAbbreviations reads the built-in packs and then any packs found in
+// dir. Entries from dir are added to the built-in pack of the same language.
+func LoadAbbreviations(dir string) (*AbbreviationPacks, error) {
+	log.Println("Loading abbreviation packs")
+	p := &AbbreviationPacks{packs: make(map[string][]abbreviation)}
+
+	if err := p.loadFS(builtinAbbreviations, "abbreviations"); err != nil {
+		return nil, err
+	}
+	if dir != "" {
+		log.Printf("Loading abbreviation packs from %s", dir)
+		if err := p.loadFS(os.DirFS(dir), "."); err != nil {
+			return nil, err
+		}
+	}
+
+	for language, entries := range p.packs {
+		log.Printf("Abbreviation pack %s: %d entries", language, len(entries))
+	}
+	return p, nil
+}
+
+func (p *AbbreviationPacks) loadFS(fsys fs.FS, dir string) error {
+	matches, err := fs.Glob(fsys, path.Join(dir, "*.txt"))
+	if err != nil {
+		return err
+	}
+
+	for _, file := range matches {
+		language := strings.TrimSuffix(path.Base(file), ".txt")
+		f, err := fsys.Open(file)
+		if err != nil {
+			log.Printf("Failed to open abbreviation pack %s: %v", file, err)
+			return err
+		}
+
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if entry, ok := parseAbbreviation(scanner.Text()); ok {
+				p.packs[language] = append(p.packs[language], entry)
+			}
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			log.Printf("Failed to read abbreviation pack %s: %v", file, err)
+			return err
+		}
+	}
+	return nil
+}
+
+func parseAbbreviation(line string) (abbreviation, bool) {
+	if i := strings.Index(line, "#"); i >= 0 {
+		line = line[:i]
+	}
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return abbreviation{}, false
+	}
+
+	final := false
+	if text, ok := strings.CutSuffix(line, " final"); ok {
+		line = strings.TrimSpace(text)
+		final = true
+	}
+	if !strings.HasSuffix(line, ".") {
+		line += "."
+	}
+	return abbreviation{text: line, final: final}, true
+}
+
+// For returns the abbreviations for a language, falling back to English
+// when there is no pack for it, plus any user-supplied extra abbreviations.
+func (p *AbbreviationPacks) For(language string, extra []string) *Abbreviations {
+	entries, ok := p.packs[language]
+	if !ok {
+		entries = p.packs[defaultAbbreviationLanguage]
+	}
+
+	a := &Abbreviations{byLastToken: make(map[string][]abbreviation)}
+	for _, entry := range entries {
+		a.add(entry)
+	}
+	for _, text := range extra {
+		if entry, ok := parseAbbreviation(text); ok {
+			a.add(entry)
+		}
+	}
+	return a
+}
+
+// add indexes an abbreviation. For abbreviations spanning several tokens
+// ("z. B.") every leading part that ends in a full stop is protected too, so
+// segmentation does not stop inside the abbreviation.
+func (a *Abbreviations) add(entry abbreviation) {
+	fields := strings.Fields(entry.text)
+	for i := range fields {
+		if !strings.HasSuffix(fields[i], ".") {
+			continue
+		}
+		part := entry
+		if i < len(fields)-1 {
+			part = abbreviation{text: strings.Join(fields[:i+1], " ")}
+		}
+		key := strings.ToLower(fields[i])
+		a.byLastToken[key] = append(a.byLastToken[key], part)
+	}
+}
+
+// match reports whether the full stop at runes[dot] ends a known
+// abbreviation, and if so whether that abbreviation may end a sentence.
+// Abbreviations starting with a lowercase letter also match capitalised
+// (e.g. "Approx." at the start of a sentence); others match exactly.
+func (a *Abbreviations) match(runes []rune, dot int) (found, final bool) {
+	if a == nil {
+		return false, false
+	}
+
+	tokenStart := dot
+	for tokenStart > 0 && !unicode.IsSpace(runes[tokenStart-1]) {
+		tokenStart--
+	}
+	token := strings.TrimLeftFunc(string(runes[tokenStart:dot+1]), isOpener)
+
+	for _, entry := range a.byLastToken[strings.ToLower(token)] {
+		n := utf8.RuneCountInString(entry.text)
+		start := dot + 1 - n
+		if start < 0 {
+			continue
+		}
+		if start > 0 && !unicode.IsSpace(runes[start-1]) && !isOpener(runes[start-1]) {
+			continue
+		}
+
+		candidate := string(runes[start : dot+1])
+		first, _ := utf8.DecodeRuneInString(entry.text)
+		if candidate == entry.text || (unicode.IsLower(first) && strings.EqualFold(candidate, entry.text)) {
+			return true, entry.final
+		}
+	}
+	return false, false
+}
+
+func isOpener(r rune) bool {
+	return strings.ContainsRune("\"'“‘«‹([{", r) || unicode.Is(unicode.Ps, r) || unicode.Is(unicode.Pi, r)
+}
@@ -0,0 +1,128 @@
+package chunker
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strings"
+)
+
+// Strategy selects how sentences are packed into chunks.
+type Strategy string
+
+const (
+	// StrategyGreedy fills each chunk up to the limit before starting the
+	// next one, which can leave a short final chunk.
+	StrategyGreedy Strategy = "greedy"
+	// StrategyBalanced uses the smallest number of chunks that fit and
+	// spreads the sentences evenly across them.
+	StrategyBalanced Strategy = "balanced"
+)
+
+func ParseStrategy(s string) (Strategy, error) {
+	switch Strategy(strings.ToLower(strings.TrimSpace(s))) {
+	case "", StrategyGreedy:
+		return StrategyGreedy, nil
+	case StrategyBalanced:
+		return StrategyBalanced, nil
+	}
+	return "", fmt.Errorf("unknown chunk strategy %q", s)
+}
+
+// load is the size of a chunk as a fraction of the tightest limit.
+func (o Options) load(words, tokens int) float64 {
+	load := 0.0
+	if o.ChunkSize > 0 {
+		load = float64(words) / float64(o.ChunkSize)
+	}
+	if o.ChunkTokens > 0 {
+		load = math.Max(load, float64(tokens)/float64(o.ChunkTokens))
+	}
+	return load
+}
+
+// balanceChunks distributes sentences over the smallest number of chunks
+// that keeps every chunk within the limits, aiming for equal sizes. Each cut
+// goes to the position closest to its ideal share of the text, where
+// section and paragraph boundaries are preferred over cuts mid-paragraph.
+// As with greedy packing, a chunk never ends on a heading or scene break.
+func balanceChunks(sentences []sentence, opts Options) [][]sentence {
+	if len(sentences) == 0 {
+		return nil
+	}
+
+	words := make([]int, len(sentences)+1)
+	tokens := make([]int, len(sentences)+1)
+	for i, s := range sentences {
+		words[i+1] = words[i] + s.words
+		tokens[i+1] = tokens[i] + s.tokens
+	}
+	n := len(sentences)
+	total := opts.load(words[n], tokens[n])
+
+	for count := max(1, int(math.Ceil(total))); count <= n; count++ {
+		cuts, ok := balancedCuts(sentences, opts, words, tokens, count)
+		if !ok {
+			continue
+		}
+
+		log.Printf("Balanced %d sentences into %d chunks", n, count)
+		var chunks [][]sentence
+		start := 0
+		for _, end := range append(cuts, n) {
+			chunks = append(chunks, sentences[start:end:end])
+			log.Printf("Created chunk with %d words, %d tokens", words[end]-words[start], tokens[end]-tokens[start])
+			start = end
+		}
+		return chunks
+	}
+
+	log.Printf("Could not balance %d sentences, falling back to greedy packing", n)
+	return createChunksFromSentences(sentences, opts)
+}
+
+// balancedCuts picks count-1 cut positions. It reports false if the
+// sentences cannot be split into count chunks within the limits this way.
+func balancedCuts(sentences []sentence, opts Options, words, tokens []int, count int) ([]int, bool) {
+	n := len(sentences)
+	total := opts.load(words[n], tokens[n])
+	share := total / float64(count)
+
+	var cuts []int
+	start := 0
+	for k := 1; k < count; k++ {
+		ideal := share * float64(k)
+		best, bestScore := -1, math.Inf(1)
+		for end := start + 1; end < n; end++ {
+			if opts.exceeds(words[end]-words[start], tokens[end]-tokens[start]) {
+				break
+			}
+			last := sentences[end-1]
+			if last.sectionStart && last.paragraphStart {
+				continue
+			}
+
+			score := math.Abs(opts.load(words[end], tokens[end]) - ideal)
+			switch next := sentences[end]; {
+			case next.sectionStart:
+			case next.paragraphStart:
+				score += share * 0.1
+			default:
+				score += share * 0.3
+			}
+			if score < bestScore {
+				best, bestScore = end, score
+			}
+		}
+		if best < 0 {
+			return nil, false
+		}
+		cuts = append(cuts, best)
+		start = best
+	}
+
+	if opts.exceeds(words[n]-words[start], tokens[n]-tokens[start]) {
+		return nil, false
+	}
+	return cuts, true
+}
@@ -0,0 +1,204 @@
+package chunker
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// boundaryContext describes a candidate sentence boundary: the terminator
+// run runes[first:end] (including trailing closers) inside the sentence that
+// started at runes[start]. next is the first non-space rune after the run,
+// or len(runes) at the end of the text.
+type boundaryContext struct {
+	runes         []rune
+	start         int
+	first         int
+	end           int
+	next          int
+	abbreviations *Abbreviations
+}
+
+type verdict int
+
+const (
+	undecided verdict = iota
+	breakHere
+	noBreak
+)
+
+// boundaryRule is one entry of the boundary rule table. Rules are tried in
+// order and the first one that decides wins; a run no rule decides ends the
+// sentence.
+type boundaryRule struct {
+	name   string
+	decide func(c boundaryContext) verdict
+}
+
+var (
+	numeralTokenPattern = regexp.MustCompile(`^(?:\d{1,3}|[a-zA-Z]|[ivxlcdmIVXLCDM]{1,6})\.$`)
+	ordinalTokenPattern = regexp.MustCompile(`^\d{1,2}\.$`)
+	monthNames          = map[string]bool{}
+	sentenceOpeners     = map[string]bool{}
+)
+
+func init() {
+	for _, month := range strings.Fields(`
+		january february march april may june july august september october november december
+		januar jänner februar märz mai juni juli oktober dezember
+		janvier février mars avril juin juillet août septembre octobre novembre décembre
+		enero febrero marzo abril mayo junio julio agosto septiembre octubre noviembre diciembre`) {
+		monthNames[month] = true
+	}
+	for _, word := range strings.Fields(`
+		A An The This That These Those It Its He She We They I You My Our Your His Her Their
+		In On At By For From To With As If When Then There Here But And Or So Now After Before
+		What Why How Who Where Which Der Die Das Ein Eine Es Er Sie Wir Le La Les Il Elle Nous
+		El Los Las Un Una`) {
+		sentenceOpeners[word] = true
+	}
+}
+
+// boundaryRules decides whether a terminator run ends a sentence.
+var boundaryRules = []boundaryRule{
+	// "你好。我们" - scripts without spaces end a sentence at the terminator.
+	{"unspaced terminator", func(c boundaryContext) verdict {
+		for _, r := range c.runes[c.first:c.end] {
+			if strings.ContainsRune(unspacedTerminators, r) {
+				return breakHere
+			}
+		}
+		return undecided
+	}},
+	{"end of text", func(c boundaryContext) verdict {
+		if c.end == len(c.runes) {
+			return breakHere
+		}
+		return undecided
+	}},
+	// "3.14 meters", "1.000.000", "v2.1.3" - a full stop between digits.
+	{"decimal", func(c boundaryContext) verdict {
+		if c.first > 0 && unicode.IsDigit(c.runes[c.first-1]) && unicode.IsDigit(c.runes[c.end]) {
+			return noBreak
+		}
+		return undecided
+	}},
+	// "example.com", "Yahoo!News" - a terminator inside a token.
+	{"no following space", func(c boundaryContext) verdict {
+		if !unicode.IsSpace(c.runes[c.end]) {
+			return noBreak
+		}
+		return undecided
+	}},
+	// "Wait... what?" / "\"Why?\" she asked." / "(see below.) and" - a
+	// lowercase word after any terminator run continues the sentence.
+	{"lowercase continuation", func(c boundaryContext) verdict {
+		if c.next < len(c.runes) && unicode.IsLower(c.runes[c.next]) {
+			return noBreak
+		}
+		return undecided
+	}},
+	// Question and exclamation marks end the sentence before anything else.
+	{"strong terminator", func(c boundaryContext) verdict {
+		for _, r := range c.runes[c.first:c.end] {
+			if isTerminator(r) && r != '.' && r != '…' {
+				return breakHere
+			}
+		}
+		return undecided
+	}},
+	// "I wonder... Maybe not." - an ellipsis followed by a capital ends it.
+	{"ellipsis", func(c boundaryContext) verdict {
+		if c.first+1 < c.end && isTerminator(c.runes[c.first+1]) || c.runes[c.first] == '…' {
+			return breakHere
+		}
+		return undecided
+	}},
+	// "1. Introduction", "b. Scope", "iv. Results" - list numbering at the
+	// start of a sentence.
+	{"list numbering", func(c boundaryContext) verdict {
+		tokenStart := c.tokenStart()
+		if strings.TrimSpace(string(c.runes[c.start:tokenStart])) == "" &&
+			numeralTokenPattern.MatchString(string(c.runes[tokenStart:c.first+1])) {
+			return noBreak
+		}
+		return undecided
+	}},
+	// "am 3. Mai", "le 14. juillet" - a day number followed by a month.
+	{"ordinal", func(c boundaryContext) verdict {
+		if !ordinalTokenPattern.MatchString(string(c.runes[c.tokenStart() : c.first+1])) {
+			return undecided
+		}
+		if monthNames[strings.ToLower(c.nextWord())] {
+			return noBreak
+		}
+		return undecided
+	}},
+	{"abbreviation", func(c boundaryContext) verdict {
+		found, final := c.abbreviations.match(c.runes, c.first)
+		if !found {
+			return undecided
+		}
+		if final && c.next < len(c.runes) && unicode.IsUpper(c.runes[c.next]) {
+			return breakHere
+		}
+		return noBreak
+	}},
+	// "J. R. R. Tolkien" - a single capital letter followed by a capitalised
+	// word is an initial, unless that word usually starts a sentence ("The
+	// answer is A. The next is B.").
+	{"initial", func(c boundaryContext) verdict {
+		tokenStart := c.tokenStart()
+		if c.first-tokenStart != 1 || !unicode.IsUpper(c.runes[tokenStart]) ||
+			c.next >= len(c.runes) || !unicode.IsUpper(c.runes[c.next]) {
+			return undecided
+		}
+		word := c.nextWord()
+		followedByInitial := len([]rune(word)) == 1 && c.next+1 < len(c.runes) && c.runes[c.next+1] == '.'
+		if !followedByInitial && sentenceOpeners[word] {
+			return breakHere
+		}
+		return noBreak
+	}},
+}
+
+// isSentenceBoundary decides whether the terminator run runes[first:end]
+// ends the sentence that started at runes[start].
+func isSentenceBoundary(runes []rune, start, first, end int, abbreviations *Abbreviations) bool {
+	next := end
+	for next < len(runes) && unicode.IsSpace(runes[next]) {
+		next++
+	}
+	c := boundaryContext{runes: runes, start: start, first: first, end: end, next: next, abbreviations: abbreviations}
+
+	for _, rule := range boundaryRules {
+		switch rule.decide(c) {
+		case breakHere:
+			return true
+		case noBreak:
+			return false
+		}
+	}
+	return true
+}
+
+// tokenStart is the index of the first rune of the token the terminator run
+// belongs to, skipping opening quotes and brackets.
+func (c boundaryContext) tokenStart() int {
+	i := c.first
+	for i > c.start && !unicode.IsSpace(c.runes[i-1]) {
+		i--
+	}
+	for i < c.first && isOpener(c.runes[i]) {
+		i++
+	}
+	return i
+}
+
+func (c boundaryContext) nextWord() string {
+	i := c.next
+	for i < len(c.runes) && unicode.IsLetter(c.runes[i]) {
+		i++
+	}
+	return string(c.runes[c.next:i])
+}
@@ -0,0 +1,54 @@
+package chunker
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSplitIntoSentences(t *testing.T) {
+	packs, err := LoadAbbreviations("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		language string
+		text     string
+		want     []string
+	}{
+		{"plain", "en", "It rained. We stayed in.", []string{"It rained.", "We stayed in."}},
+		{"decimal", "en", "Pi is 3.14 exactly. Or close.", []string{"Pi is 3.14 exactly.", "Or close."}},
+		{"version", "en", "Use v2.1.3 now. It works.", []string{"Use v2.1.3 now.", "It works."}},
+		{"ellipsis then capital", "en", "I wonder... Maybe not.", []string{"I wonder...", "Maybe not."}},
+		{"ellipsis then lowercase", "en", "Wait... what happened?", []string{"Wait... what happened?"}},
+		{"unicode ellipsis", "en", "So it goes… Then silence.", []string{"So it goes…", "Then silence."}},
+		{"question in quotes", "en", `"Why?" she asked. Nobody knew.`, []string{`"Why?" she asked.`, "Nobody knew."}},
+		{"question closes quote", "en", `He said "Why not?" Then he left.`, []string{`He said "Why not?"`, "Then he left."}},
+		{"ellipsis closes quote", "en", `She whispered "and then..." The door opened.`, []string{`She whispered "and then..."`, "The door opened."}},
+		{"initials", "en", "J. R. R. Tolkien wrote it. He was English.", []string{"J. R. R. Tolkien wrote it.", "He was English."}},
+		{"middle initial", "en", "John F. Kennedy spoke. Crowds cheered.", []string{"John F. Kennedy spoke.", "Crowds cheered."}},
+		{"initial before initial", "en", "By J. I. Smith. The end.", []string{"By J. I. Smith.", "The end."}},
+		{"answer letters", "en", "The answer is A. The next is B.", []string{"The answer is A.", "The next is B."}},
+		{"ordinal date", "de", "Wir kommen am 3. Mai an. Dann feiern wir.", []string{"Wir kommen am 3. Mai an.", "Dann feiern wir."}},
+		{"ordinal without month", "de", "Er wurde 3. Das war gut.", []string{"Er wurde 3.", "Das war gut."}},
+		{"list numbering", "en", "1. Introduction to the topic", []string{"1. Introduction to the topic"}},
+		{"roman list numbering", "en", "iv. Results and discussion", []string{"iv. Results and discussion"}},
+		{"abbreviation", "en", "Dr. Smith arrived. He sat down.", []string{"Dr. Smith arrived.", "He sat down."}},
+		{"final abbreviation", "en", "He met Bob Jones Jr. The meeting went well.", []string{"He met Bob Jones Jr.", "The meeting went well."}},
+		{"spaced abbreviation", "de", "Das gilt z. B. hier. Sonst nicht.", []string{"Das gilt z. B. hier.", "Sonst nicht."}},
+		{"domain name", "en", "Visit example.com today. Thanks.", []string{"Visit example.com today.", "Thanks."}},
+		{"chinese", "zh", "你好。我们走吧！好的？", []string{"你好。", "我们走吧！", "好的？"}},
+		{"japanese", "ja", "今日は晴れです。明日は雨です。", []string{"今日は晴れです。", "明日は雨です。"}},
+		{"hindi danda", "hi", "यह एक वाक्य है। यह दूसरा है।", []string{"यह एक वाक्य है।", "यह दूसरा है।"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitIntoSentences(tt.text, packs.For(tt.language, nil))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("splitIntoSentences(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
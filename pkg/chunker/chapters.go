@@ -0,0 +1,244 @@
+package chunker
+
+import (
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Chapter is a part of the text cut at a chapter heading. Level is the
+// level of the heading in Markdown input ("## " is 2), or 0 if the input was
+// not Markdown.
+type Chapter struct {
+	Index int
+	Title string
+	Level int
+	Text  string
+}
+
+// Chunk is a piece of text to process. Context holds the end of the
+// previous chunk when chunks overlap; it is for reference only and is not
+// part of the chunk's own text.
+//
+// Verbatim holds the Markdown code blocks and tables that Text refers to by
+// placeholder; Restore puts them back into prose output, and DropVerbatim
+// removes the placeholders from the list modes' output.
+//
+// Sentences, Words and Tokens are the sizes the packer worked with. Start
+// and End are character offsets of the chunk in the source text; they are
+// only set by LocateChunks.
+type Chunk struct {
+	Text      string
+	Context   string
+	Chapter   int
+	Verbatim  []string
+	Sentences int
+	Words     int
+	Tokens    int
+	Start     int
+	End       int
+}
+
+var (
+	chapterPattern         = regexp.MustCompile(`(?i)^(?:chapter|part|book)\s+(?:\d+|[ivxlcdm]+|one|two|three|four|five|six|seven|eight|nine|ten|eleven|twelve|thirteen|fourteen|fifteen|sixteen|seventeen|eighteen|nineteen|twenty)\b`)
+	topLevelNumberPattern  = regexp.MustCompile(`^\d+\.?\s+\S`)
+	markdownChapterPattern = regexp.MustCompile(`^#\s+\S`)
+)
+
+// DetectChapters splits content at chapter headings. outline holds chapter
+// titles from another source (e.g. PDF bookmarks); when at least two of them
+// are found as headings they take precedence over pattern matching.
+// Otherwise the first of these heading styles that occurs at least twice
+// wins: "Chapter 12" / "PART II" / "Book One", a Markdown "# " heading, or a
+// top-level numbered heading ("3 Methods"). Text before the first chapter
+// becomes an untitled chapter. If no chapters are found the whole content is
+// returned as a single untitled chapter. If markdown is set the content is
+// parsed as Markdown, so that only real headings can start a chapter.
+func DetectChapters(content string, outline []string, markdown bool) []Chapter {
+	paragraphs := parseParagraphs(content, markdown)
+
+	var outlineTitles []string
+	for _, title := range outline {
+		if key := normalizeTitle(title); key != "" {
+			outlineTitles = append(outlineTitles, key)
+		}
+	}
+
+	// Numbered list items separated by blank lines ("1. Preheat the oven")
+	// look like numbered headings; they are told apart by their short
+	// bodies.
+	matchers := []struct {
+		name     string
+		match    func(p paragraph) bool
+		longBody bool
+	}{
+		{"outline", func(p paragraph) bool {
+			return len(p.text) <= 120 && matchesOutline(p, outlineTitles)
+		}, false},
+		{"chapter keyword", func(p paragraph) bool {
+			return p.kind == kindHeading && chapterPattern.MatchString(strings.TrimLeft(p.text, "# "))
+		}, false},
+		{"markdown", func(p paragraph) bool {
+			return p.kind == kindHeading && markdownChapterPattern.MatchString(p.text)
+		}, false},
+		{"numbered", func(p paragraph) bool {
+			return p.kind == kindHeading && topLevelNumberPattern.MatchString(p.text)
+		}, true},
+	}
+
+	for _, m := range matchers {
+		var starts []int
+		for i, p := range paragraphs {
+			if m.match(p) {
+				starts = append(starts, i)
+			}
+		}
+		if len(starts) < 2 {
+			continue
+		}
+		if m.longBody && medianBodyWords(paragraphs, starts) < minChapterWords {
+			log.Printf("Ignoring %d %s headings with short bodies", len(starts), m.name)
+			continue
+		}
+
+		chapters := buildChapters(paragraphs, starts, markdown)
+		log.Printf("Detected %d chapters using %s headings", len(chapters), m.name)
+		return chapters
+	}
+
+	log.Println("No chapter headings detected, treating text as a single chapter")
+	return []Chapter{{Index: 0, Text: renderParagraphs(paragraphs)}}
+}
+
+// minChapterWords is the median body length numbered headings need to be
+// taken as chapters rather than the items of a numbered list.
+const minChapterWords = 80
+
+// medianBodyWords returns the median number of words between each heading
+// position and the next.
+func medianBodyWords(paragraphs []paragraph, starts []int) int {
+	counts := make([]int, len(starts))
+	for i, start := range starts {
+		end := len(paragraphs)
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+		for _, p := range paragraphs[start+1 : end] {
+			counts[i] += wordCount(p.text)
+		}
+	}
+	slices.Sort(counts)
+	return counts[len(counts)/2]
+}
+
+// buildChapters cuts paragraphs at the given heading positions. A chapter
+// consisting of nothing but its heading (e.g. "PART II" directly followed by
+// "Chapter 5") is folded into the title of the next chapter, and a subtitle
+// line under a chapter heading is folded into that chapter's title. If
+// markdown is set each chapter keeps the level of its heading.
+func buildChapters(paragraphs []paragraph, starts []int, markdown bool) []Chapter {
+	var chapters []Chapter
+
+	if starts[0] > 0 {
+		chapters = append(chapters, Chapter{Text: renderParagraphs(paragraphs[:starts[0]])})
+	}
+
+	pendingTitle, pendingLevel := "", 0
+	for i, start := range starts {
+		end := len(paragraphs)
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+
+		title := strings.TrimSpace(strings.TrimLeft(paragraphs[start].text, "#"))
+		level := 0
+		if markdown {
+			level = max(1, headingLevel(paragraphs[start].text))
+		}
+		if pendingTitle != "" {
+			title = pendingTitle + " — " + title
+			level = pendingLevel
+			pendingTitle = ""
+		}
+
+		bodyStart := start + 1
+		if bodyStart < end-1 && paragraphs[bodyStart].kind == kindHeading {
+			// A heading directly under the chapter heading is its subtitle.
+			title += ": " + strings.TrimSpace(strings.TrimLeft(paragraphs[bodyStart].text, "#"))
+			bodyStart++
+		}
+
+		body := renderParagraphs(paragraphs[bodyStart:end])
+		if body == "" {
+			pendingTitle, pendingLevel = title, level
+			continue
+		}
+		chapters = append(chapters, Chapter{Title: title, Level: level, Text: body})
+	}
+	if pendingTitle != "" {
+		chapters = append(chapters, Chapter{Title: pendingTitle, Level: pendingLevel})
+	}
+
+	for i := range chapters {
+		chapters[i].Index = i
+	}
+	return chapters
+}
+
+// headingLevel returns the number of "#" a Markdown heading starts with.
+func headingLevel(text string) int {
+	return len(text) - len(strings.TrimLeft(text, "#"))
+}
+
+// ChunkChapters chunks each chapter separately so that no chunk straddles
+// a chapter boundary.
+func ChunkChapters(chapters []Chapter, opts Options) ([]Chunk, error) {
+	var chunks []Chunk
+	for _, chapter := range chapters {
+		if strings.TrimSpace(chapter.Text) == "" {
+			continue
+		}
+		log.Printf("Chunking chapter %d %q", chapter.Index+1, chapter.Title)
+		chapterChunks, err := ChunkText(chapter.Text, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range chapterChunks {
+			c.Chapter = chapter.Index
+			chunks = append(chunks, c)
+		}
+	}
+	return chunks, nil
+}
+
+// matchesOutline reports whether a paragraph is one of the outline titles,
+// or the start of one when the title is split over two heading lines
+// ("Chapter 1" / "The Boy Who Lived").
+func matchesOutline(p paragraph, titles []string) bool {
+	key := normalizeTitle(p.text)
+	if key == "" {
+		return false
+	}
+	for _, title := range titles {
+		if key == title || (p.kind == kindHeading && strings.HasPrefix(title, key+" ")) {
+			return true
+		}
+	}
+	return false
+}
+
+func renderParagraphs(paragraphs []paragraph) string {
+	texts := make([]string, len(paragraphs))
+	for i, p := range paragraphs {
+		texts[i] = p.text
+	}
+	return strings.Join(texts, "\n\n")
+}
+
+func normalizeTitle(s string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}), " ")
+}
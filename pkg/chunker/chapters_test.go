@@ -0,0 +1,45 @@
+package chunker
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDetectChaptersNumbered(t *testing.T) {
+	body := strings.Repeat("The study looked at many things over a long time. ", 12)
+
+	tests := []struct {
+		name   string
+		text   string
+		titles []string
+	}{
+		{
+			name:   "numbered sections",
+			text:   "1 Introduction\n\n" + body + "\n\n2 Methods\n\n" + body + "\n\n3 Results\n\n" + body,
+			titles: []string{"1 Introduction", "2 Methods", "3 Results"},
+		},
+		{
+			name:   "recipe steps",
+			text:   "Bake the bread as follows.\n\n1. Preheat the oven\n\n2. Mix the flour and water\n\n3. Knead the dough\n\n4. Bake for an hour",
+			titles: []string{""},
+		},
+		{
+			name:   "steps with short notes",
+			text:   "1. Preheat the oven\n\nIt should be hot.\n\n2. Mix the flour\n\nUse a big bowl.\n\n3. Knead the dough\n\nTen minutes is enough.",
+			titles: []string{""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chapters := DetectChapters(tt.text, nil, false)
+			var titles []string
+			for _, c := range chapters {
+				titles = append(titles, c.Title)
+			}
+			if strings.Join(titles, "|") != strings.Join(tt.titles, "|") {
+				t.Errorf("DetectChapters() titles = %q, want %q", titles, tt.titles)
+			}
+		})
+	}
+}
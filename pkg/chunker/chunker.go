@@ -1,105 +1,254 @@
 package chunker
 
 import (
+	"errors"
 	"log"
+	"pdf-processor/pkg/tokens"
 	"strings"
-	"unicode"
 )
 
-func ChunkText(content string, chunkSize int) ([]string, error) {
-	log.Printf("Starting text chunking with chunk size %d words", chunkSize)
-
-	content = strings.ReplaceAll(content, "\r\n", " ")
-	content = strings.ReplaceAll(content, "\n", " ")
+// Options controls chunking. ChunkSize caps a chunk in words and ChunkTokens
+// in estimated tokens; a zero limit is not enforced, but at least one must be
+// set. Strategy defaults to greedy packing. Overlap is the number of
+// sentences from the end of the previous chunk passed along with each chunk
+// as context. Markdown parses the text as Markdown, keeping code blocks and
+// tables out of the model's reach.
+type Options struct {
+	ChunkSize     int
+	ChunkTokens   int
+	Strategy      Strategy
+	Overlap       int
+	Markdown      bool
+	Abbreviations *Abbreviations
+}
 
-	sentences := splitIntoSentences(content)
-	log.Printf("Split content into %d sentences", len(sentences))
+// exceeds reports whether a chunk of the given size is over either limit.
+func (o Options) exceeds(words, tokens int) bool {
+	return (o.ChunkSize > 0 && words > o.ChunkSize) || (o.ChunkTokens > 0 && tokens > o.ChunkTokens)
+}
 
-	return createChunksFromSentences(sentences, chunkSize), nil
+// halfFull reports whether a chunk of the given size has reached half of
+// every limit.
+func (o Options) halfFull(words, tokens int) bool {
+	return words >= o.ChunkSize/2 && tokens >= o.ChunkTokens/2
 }
 
-func splitIntoSentences(text string) []string {
-	log.Printf("Splitting text into sentences, text length: %d characters", len(text))
+func (o Options) validate() error {
+	if o.ChunkSize <= 0 && o.ChunkTokens <= 0 {
+		return errors.New("chunker: no chunk size or token budget set")
+	}
+	return nil
+}
 
-	text = replaceAbbreviations(text)
+func ChunkText(content string, opts Options) ([]Chunk, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	log.Printf("Starting text chunking with chunk size %d words, %d tokens", opts.ChunkSize, opts.ChunkTokens)
 
-	var sentences []string
-	var currentSentence strings.Builder
+	paragraphs := parseParagraphs(content, opts.Markdown)
+	log.Printf("Split content into %d paragraphs", len(paragraphs))
 
-	for i := range text {
-		currentSentence.WriteByte(text[i])
+	var sentences []sentence
+	for _, p := range paragraphs {
+		sentences = appendSentences(sentences, p, opts)
+	}
+	log.Printf("Split content into %d sentences", len(sentences))
 
-		if (text[i] == '.' || text[i] == '!' || text[i] == '?') &&
-			(i == len(text)-1 || unicode.IsSpace(rune(text[i+1]))) {
+	var groups [][]sentence
+	if opts.Strategy == StrategyBalanced {
+		groups = balanceChunks(sentences, opts)
+	} else {
+		groups = createChunksFromSentences(sentences, opts)
+	}
 
-			sentence := strings.TrimSpace(currentSentence.String())
-			if len(strings.Fields(sentence)) > 0 {
-				sentences = append(sentences, sentence)
-			}
-			currentSentence.Reset()
+	var chunks []Chunk
+	for i, group := range groups {
+		chunk := newChunk(group)
+		if i > 0 && opts.Overlap > 0 {
+			chunk.Context = renderSentences(overlapSentences(groups[i-1], opts.Overlap))
 		}
+		chunks = append(chunks, chunk)
 	}
+	return chunks, nil
+}
 
-	if currentSentence.Len() > 0 {
-		sentence := strings.TrimSpace(currentSentence.String())
-		if len(strings.Fields(sentence)) > 0 {
-			sentences = append(sentences, sentence)
+// appendSentences splits a paragraph into sentences for the packer. Headings,
+// scene breaks and verbatim blocks stay whole and lists are split into their
+// lines; sentences, list lines and headings that exceed the chunk limits on
+// their own are split further. A verbatim block is sized as the placeholder
+// that replaces it, and never split.
+func appendSentences(sentences []sentence, p paragraph, opts Options) []sentence {
+	texts := []string{p.text}
+	switch p.kind {
+	case kindText:
+		texts = splitIntoSentences(p.text, opts.Abbreviations)
+	case kindList:
+		texts = strings.Split(p.text, "\n")
+	}
+	for i, text := range texts {
+		sized := text
+		if p.kind == kindVerbatim {
+			sized = placeholder(1)
+		}
+		s := sentence{
+			text:           text,
+			words:          wordCount(sized),
+			tokens:         tokens.Estimate(sized),
+			paragraphStart: i == 0,
+			sectionStart:   i == 0 && (p.kind == kindHeading || p.kind == kindBreak),
+			lineStart:      i > 0 && p.kind == kindList,
+			heading:        p.kind == kindHeading,
+			verbatim:       p.kind == kindVerbatim,
+		}
+		if p.kind != kindVerbatim && opts.exceeds(s.words, s.tokens) {
+			sentences = append(sentences, splitOversized(s, opts)...)
+			continue
 		}
+		sentences = append(sentences, s)
 	}
-
-	log.Printf("Found %d sentences in text", len(sentences))
 	return sentences
 }
 
-func createChunksFromSentences(sentences []string, targetChunkSize int) []string {
-	var chunks []string
-	var currentChunk strings.Builder
-	currentWordCount := 0
+// packer packs sentences greedily into chunks within the word and token
+// limits of opts. When a chunk overflows it is cut at the latest section
+// boundary, else the latest paragraph boundary, that keeps at least half a
+// chunk's worth of text; only if neither exists is it cut mid-paragraph. A
+// chunk never ends on a heading or scene break.
+type packer struct {
+	opts    Options
+	current []sentence
+	words   int
+	tokens  int
+}
 
-	for i, sentence := range sentences {
-		sentenceWords := len(strings.Fields(sentence))
+// add adds a sentence and returns the chunks it closed, if any. A cut made
+// at an earlier boundary leaves sentences behind, which are cut again if s
+// still does not fit after them.
+func (p *packer) add(s sentence) [][]sentence {
+	var closed [][]sentence
+	for p.words > 0 && p.opts.exceeds(p.words+s.words, p.tokens+s.tokens) {
+		n := chooseBreak(p.current, s, p.opts)
+		chunk := p.current[:n:n]
+		words, tokens := countSize(chunk)
+		log.Printf("Created chunk with %d words, %d tokens", words, tokens)
+		closed = append(closed, chunk)
+
+		p.current = append([]sentence(nil), p.current[n:]...)
+		p.words, p.tokens = countSize(p.current)
+	}
 
-		if currentWordCount > 0 && currentWordCount+sentenceWords > targetChunkSize {
-			chunk := strings.TrimSpace(currentChunk.String())
-			chunks = append(chunks, chunk)
-			log.Printf("Created chunk with %d words", currentWordCount)
+	p.current = append(p.current, s)
+	p.words += s.words
+	p.tokens += s.tokens
+	return closed
+}
 
-			currentChunk.Reset()
-			currentWordCount = 0
-		}
+// flush returns the last, partly filled chunk, if any.
+func (p *packer) flush() []sentence {
+	if len(p.current) == 0 {
+		return nil
+	}
+	log.Printf("Created final chunk with %d words, %d tokens", p.words, p.tokens)
+	closed := p.current
+	p.current, p.words, p.tokens = nil, 0, 0
+	return closed
+}
 
-		currentChunk.WriteString(sentence + " ")
-		currentWordCount += sentenceWords
+// createChunksFromSentences packs a complete list of sentences greedily.
+func createChunksFromSentences(sentences []sentence, opts Options) [][]sentence {
+	var chunks [][]sentence
+	p := &packer{opts: opts}
 
+	for i, s := range sentences {
+		chunks = append(chunks, p.add(s)...)
 		if i > 0 && i%100 == 0 {
 			log.Printf("Processed %d/%d sentences", i, len(sentences))
 		}
 	}
-
-	if currentChunk.Len() > 0 {
-		chunk := strings.TrimSpace(currentChunk.String())
-		chunks = append(chunks, chunk)
-		log.Printf("Created final chunk with %d words", currentWordCount)
+	if closed := p.flush(); closed != nil {
+		chunks = append(chunks, closed)
 	}
 
 	log.Printf("Created %d chunks from %d sentences", len(chunks), len(sentences))
 	return chunks
 }
 
-func replaceAbbreviations(text string) string {
-	abbreviations := []string{
-		"Mr.", "Mrs.", "Ms.", "Dr.", "Prof.",
-		"Inc.", "Ltd.", "Co.", "Corp.",
-		"i.e.", "e.g.", "etc.",
-		"vs.", "a.m.", "p.m.",
-		"U.S.", "U.K.", "E.U.",
+// chooseBreak returns how many sentences of current go into the chunk being
+// closed, given that next no longer fits.
+func chooseBreak(current []sentence, next sentence, opts Options) int {
+	best := len(current)
+	if !next.sectionStart {
+		bestParagraph, bestSection := -1, -1
+		words, tokens := 0, 0
+		for i, s := range current {
+			if i > 0 && opts.halfFull(words, tokens) {
+				if s.sectionStart {
+					bestSection = i
+				}
+				if s.paragraphStart {
+					bestParagraph = i
+				}
+			}
+			words += s.words
+			tokens += s.tokens
+		}
+
+		switch {
+		case next.paragraphStart:
+			// Cutting right here is already a paragraph boundary; only an
+			// earlier section boundary is better.
+			if bestSection > 0 {
+				best = bestSection
+			}
+		case bestSection > 0:
+			best = bestSection
+		case bestParagraph > 0:
+			best = bestParagraph
+		}
+	}
+
+	for best > 1 && current[best-1].sectionStart && current[best-1].paragraphStart {
+		best--
+	}
+	return best
+}
+
+// overlapSentences returns up to n sentences from the end of a chunk to be
+// repeated as context for the next one. It stops at a heading or scene
+// break, since context from before it belongs to another section.
+func overlapSentences(chunk []sentence, n int) []sentence {
+	start := len(chunk)
+	for start > 0 && len(chunk)-start < n {
+		if chunk[start-1].sectionStart && chunk[start-1].paragraphStart {
+			break
+		}
+		start--
 	}
+	return chunk[start:]
+}
 
-	result := text
-	for _, abbr := range abbreviations {
-		placeholder := strings.ReplaceAll(abbr, ".", "·")
-		result = strings.ReplaceAll(result, abbr, placeholder)
+func renderSentences(sentences []sentence) string {
+	var b strings.Builder
+	for i, s := range sentences {
+		if i > 0 {
+			if s.paragraphStart {
+				b.WriteString("\n\n")
+			} else if s.lineStart {
+				b.WriteString("\n")
+			} else {
+				b.WriteString(sentenceSeparator(sentences[i-1].text, s.text))
+			}
+		}
+		b.WriteString(s.text)
 	}
+	return b.String()
+}
 
-	return result
+func countSize(sentences []sentence) (words, tokens int) {
+	for _, s := range sentences {
+		words += s.words
+		tokens += s.tokens
+	}
+	return words, tokens
 }
@@ -0,0 +1,66 @@
+package chunker
+
+import (
+	"strings"
+	"testing"
+)
+
+// sentenceOf returns a sentence of the given number of words.
+func sentenceOf(word string, words int) string {
+	return word + strings.Repeat(" "+strings.ToLower(word), words-1) + "."
+}
+
+func TestChunkTextStaysWithinLimit(t *testing.T) {
+	text := sentenceOf("Alpha", 460) + "\n\n" + sentenceOf("Beta", 440) + " " + sentenceOf("Gamma", 470)
+	opts := Options{ChunkSize: 900, Strategy: StrategyGreedy}
+
+	chunks, err := ChunkText(text, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, chunk := range chunks {
+		if chunk.Words > opts.ChunkSize {
+			t.Errorf("ChunkText: chunk %d has %d words, limit %d", i, chunk.Words, opts.ChunkSize)
+		}
+	}
+
+	var streamed int
+	for chunk, err := range StreamChunks(strings.NewReader(text), opts) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if chunk.Words > opts.ChunkSize {
+			t.Errorf("StreamChunks: chunk %d has %d words, limit %d", streamed, chunk.Words, opts.ChunkSize)
+		}
+		streamed++
+	}
+	if streamed != len(chunks) {
+		t.Errorf("StreamChunks made %d chunks, ChunkText %d", streamed, len(chunks))
+	}
+}
+
+func TestChunkTextSplitsOversizedLines(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		opts Options
+	}{
+		{"list item", "Shopping:\n\n- " + sentenceOf("Apples", 3000) + "\n- Pears", Options{ChunkTokens: 500, Markdown: true}},
+		{"heading", "# " + strings.Repeat("Long heading word ", 30) + "\n\nShort body.", Options{ChunkSize: 10, Markdown: true}},
+		{"plain heading", strings.ToUpper(strings.Repeat("title ", 11)) + "\n\nShort body.", Options{ChunkSize: 5}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks, err := ChunkText(tt.text, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, chunk := range chunks {
+				if tt.opts.exceeds(chunk.Words, chunk.Tokens) {
+					t.Errorf("chunk %d has %d words, %d tokens, over the limits of %d words, %d tokens", i, chunk.Words, chunk.Tokens, tt.opts.ChunkSize, tt.opts.ChunkTokens)
+				}
+			}
+		})
+	}
+}
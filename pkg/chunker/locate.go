@@ -0,0 +1,98 @@
+package chunker
+
+import (
+	"log"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// LocateChunks sets the Start and End of each chunk to the character offsets
+// of its text in source, the text the chunks were made from. Chunking
+// normalises whitespace and turns setext headings into "#" headings, so the
+// chunk text is matched ignoring whitespace and added heading marks, and
+// source characters the chunker dropped (heading underlines) are skipped.
+// Chunks must be in source order. A chunk whose first word cannot be found
+// gets an empty range at the end of the previous chunk.
+func LocateChunks(source string, chunks []Chunk) {
+	pos, runes := 0, 0 // byte and character offset of the end of the previous chunk
+	for i := range chunks {
+		text := chunks[i].Restore(chunks[i].Text)
+		start, end, ok := locate(source, pos, text)
+		if !ok {
+			log.Printf("Could not locate chunk %d in the source text", i+1)
+			chunks[i].Start, chunks[i].End = runes, runes
+			continue
+		}
+		chunks[i].Start = runes + utf8.RuneCountInString(source[pos:start])
+		chunks[i].End = chunks[i].Start + utf8.RuneCountInString(source[start:end])
+		pos, runes = end, chunks[i].End
+	}
+}
+
+// anchorRunes is how many characters from the start of a chunk are used to
+// find it in the source. A single word is not enough: a common first word
+// would match in an earlier chapter when only one chapter is chunked.
+const anchorRunes = 32
+
+// locate finds text in source from byte offset pos and returns its byte
+// range. The start of the text is searched for allowing any whitespace
+// between characters; if it is not found, the first word is searched for.
+func locate(source string, pos int, text string) (start, end int, ok bool) {
+	trimmed := strings.TrimLeft(text, "# \t\n")
+	marked := strings.HasPrefix(text, "#")
+	if trimmed == "" {
+		return 0, 0, false
+	}
+
+	var anchor []string
+	for _, r := range trimmed {
+		if len(anchor) == anchorRunes {
+			break
+		}
+		if !unicode.IsSpace(r) {
+			anchor = append(anchor, regexp.QuoteMeta(string(r)))
+		}
+	}
+	var offset int
+	if m := regexp.MustCompile(strings.Join(anchor, `\s*`)).FindStringIndex(source[pos:]); m != nil {
+		offset = m[0]
+	} else {
+		offset = strings.Index(source[pos:], strings.Fields(trimmed)[0])
+	}
+	if offset < 0 {
+		return 0, 0, false
+	}
+	start = pos + offset
+	text = trimmed
+	if marked {
+		// Include the marks of an ATX heading in the source.
+		k := len(strings.TrimRight(source[pos:start], " \t"))
+		if marks := len(source[pos:pos+k]) - len(strings.TrimRight(source[pos:pos+k], "#")); marks > 0 {
+			start = pos + k - marks
+		}
+	}
+
+	i, j := 0, start
+	end = start
+	for i < len(text) && j < len(source) {
+		t, tSize := utf8.DecodeRuneInString(text[i:])
+		s, sSize := utf8.DecodeRuneInString(source[j:])
+		switch {
+		case unicode.IsSpace(t):
+			i += tSize
+		case unicode.IsSpace(s):
+			j += sSize
+		case t == s:
+			i += tSize
+			j += sSize
+			end = j
+		case t == '#':
+			i += tSize
+		default:
+			j += sSize
+		}
+	}
+	return start, end, true
+}
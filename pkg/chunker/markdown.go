@@ -0,0 +1,217 @@
+package chunker
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	fencePattern             = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})")
+	atxHeadingPattern        = regexp.MustCompile(`^ {0,3}#{1,6}(?:\s|$)`)
+	setextPattern            = regexp.MustCompile(`^ {0,3}(=+|-+)\s*$`)
+	thematicBreakPattern     = regexp.MustCompile(`^ {0,3}(?:(?:\*\s*){3,}|(?:-\s*){3,}|(?:_\s*){3,})$`)
+	listItemPattern          = regexp.MustCompile(`^\s*(?:[-*+]|\d{1,9}[.)])\s+`)
+	tableSeparatorPattern    = regexp.MustCompile(`^\s*\|?\s*:?-{3,}:?\s*(?:\|\s*:?-{3,}:?\s*)+\|?\s*$`)
+	placeholderPattern       = regexp.MustCompile("`*\\[\\[VERBATIM-(\\d+)\\]\\]`*")
+	placeholderLinePattern   = regexp.MustCompile("(?m)^[ \t]*(?:[-*+][ \t]+|\\d+[.)][ \t]+)?`*\\[\\[VERBATIM-\\d+\\]\\]`*[ \t]*\n?")
+	inlinePlaceholderPattern = regexp.MustCompile("[ \t]*`*\\[\\[VERBATIM-\\d+\\]\\]`*")
+)
+
+// markdownParser splits Markdown into paragraphs line by line. Fenced and
+// indented code blocks and tables become verbatim paragraphs that are never
+// split or edited; lists and block quotes keep their lines; ATX and setext
+// headings become headings and thematic breaks become scene breaks.
+type markdownParser struct {
+	kind  paragraphKind
+	fence string
+	lines []string
+}
+
+// Kinds of the block being collected; only the parser uses them.
+const (
+	blockNone paragraphKind = -1 - iota
+	blockCode
+	blockIndented
+	blockTable
+)
+
+func splitMarkdown(content string) []paragraph {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	content = strings.ReplaceAll(content, "\r", "\n")
+
+	m := &markdownParser{kind: blockNone}
+	var paragraphs []paragraph
+	for _, line := range strings.Split(content, "\n") {
+		paragraphs = append(paragraphs, m.line(line)...)
+	}
+	return append(paragraphs, m.flush()...)
+}
+
+// line adds a raw line and returns the paragraphs it completes.
+func (m *markdownParser) line(raw string) []paragraph {
+	raw = strings.TrimRight(raw, " \t\r")
+	trimmed := strings.TrimSpace(raw)
+
+	if m.kind == blockCode {
+		m.lines = append(m.lines, raw)
+		if strings.HasPrefix(trimmed, m.fence) && strings.Trim(trimmed, m.fence[:1]) == "" {
+			return m.flush()
+		}
+		return nil
+	}
+
+	if m.kind == blockIndented {
+		if trimmed == "" || strings.HasPrefix(raw, "    ") || strings.HasPrefix(raw, "\t") {
+			m.lines = append(m.lines, raw)
+			return nil
+		}
+	}
+
+	if match := fencePattern.FindStringSubmatch(raw); match != nil {
+		paragraphs := m.flush()
+		m.kind, m.fence, m.lines = blockCode, match[1], []string{raw}
+		return paragraphs
+	}
+
+	if trimmed == "" {
+		return m.flush()
+	}
+
+	if m.kind == kindText && len(m.lines) == 1 && setextPattern.MatchString(raw) {
+		level := "#"
+		if strings.HasPrefix(trimmed, "-") {
+			level = "##"
+		}
+		title := m.lines[0]
+		m.kind, m.lines = blockNone, nil
+		return []paragraph{{kind: kindHeading, text: level + " " + title}}
+	}
+
+	if m.kind == kindText && len(m.lines) == 1 && strings.Contains(m.lines[0], "|") && tableSeparatorPattern.MatchString(raw) {
+		m.kind = blockTable
+		m.lines = append(m.lines, raw)
+		return nil
+	}
+
+	switch {
+	case atxHeadingPattern.MatchString(raw):
+		return append(m.flush(), paragraph{kind: kindHeading, text: trimmed})
+	case thematicBreakPattern.MatchString(raw):
+		return append(m.flush(), paragraph{kind: kindBreak, text: trimmed})
+	case strings.HasPrefix(trimmed, "|"):
+		return m.add(blockTable, raw)
+	case m.kind == blockTable && strings.Contains(raw, "|"):
+		return m.add(blockTable, raw)
+	case listItemPattern.MatchString(raw), strings.HasPrefix(trimmed, ">"):
+		return m.add(kindList, raw)
+	case m.kind == kindList:
+		// A lazy continuation line of a list item or quote.
+		return m.add(kindList, raw)
+	case m.kind == blockNone && (strings.HasPrefix(raw, "    ") || strings.HasPrefix(raw, "\t")):
+		return m.add(blockIndented, raw)
+	}
+	return m.add(kindText, trimmed)
+}
+
+// add appends a line to a block of the given kind, first completing the
+// current block if it is of another kind.
+func (m *markdownParser) add(kind paragraphKind, line string) []paragraph {
+	var paragraphs []paragraph
+	if m.kind != kind {
+		paragraphs = m.flush()
+		m.kind = kind
+	}
+	m.lines = append(m.lines, line)
+	return paragraphs
+}
+
+// flush completes the current block.
+func (m *markdownParser) flush() []paragraph {
+	kind, lines := m.kind, m.lines
+	m.kind, m.fence, m.lines = blockNone, "", nil
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+
+	switch kind {
+	case blockCode, blockIndented, blockTable:
+		return []paragraph{{kind: kindVerbatim, text: strings.Join(lines, "\n")}}
+	case kindList:
+		return []paragraph{{kind: kindList, text: strings.Join(lines, "\n")}}
+	}
+
+	var text strings.Builder
+	text.WriteString(lines[0])
+	for i, line := range lines[1:] {
+		text.WriteString(sentenceSeparator(lines[i], line))
+		text.WriteString(line)
+	}
+	return []paragraph{{kind: kindText, text: text.String()}}
+}
+
+func placeholder(n int) string {
+	return fmt.Sprintf("[[VERBATIM-%d]]", n)
+}
+
+// newChunk renders a group of sentences as a chunk, replacing verbatim
+// blocks with numbered placeholders so that the model cannot change them.
+func newChunk(group []sentence) Chunk {
+	chunk := Chunk{Sentences: len(group)}
+	sentences := group
+	for i, s := range group {
+		chunk.Words += s.words
+		chunk.Tokens += s.tokens
+		if !s.verbatim {
+			continue
+		}
+		if len(chunk.Verbatim) == 0 {
+			sentences = append([]sentence(nil), group...)
+		}
+		chunk.Verbatim = append(chunk.Verbatim, s.text)
+		sentences[i].text = placeholder(len(chunk.Verbatim))
+	}
+	chunk.Text = renderSentences(sentences)
+	return chunk
+}
+
+// Restore puts the chunk's verbatim blocks back in place of their
+// placeholders in the model output. A placeholder the model repeated is
+// dropped after its first use, and blocks whose placeholder the model left
+// out are appended at the end so that no code or table is lost.
+func (c Chunk) Restore(output string) string {
+	if len(c.Verbatim) == 0 {
+		return output
+	}
+
+	used := make([]bool, len(c.Verbatim))
+	output = placeholderPattern.ReplaceAllStringFunc(output, func(match string) string {
+		n, _ := strconv.Atoi(placeholderPattern.FindStringSubmatch(match)[1])
+		if n < 1 || n > len(c.Verbatim) || used[n-1] {
+			return ""
+		}
+		used[n-1] = true
+		return c.Verbatim[n-1]
+	})
+
+	for i, block := range c.Verbatim {
+		if !used[i] {
+			log.Printf("Model output lost placeholder %s, appending the block at the end", placeholder(i+1))
+			output = strings.TrimRight(output, "\n") + "\n\n" + block
+		}
+	}
+	return output
+}
+
+// DropVerbatim removes placeholders from model output that does not carry
+// the chunk's verbatim blocks, as notes and flashcards do not. A line holding
+// nothing but a placeholder, or a list item of one, is removed whole.
+func DropVerbatim(output string) string {
+	output = placeholderLinePattern.ReplaceAllString(output, "")
+	return inlinePlaceholderPattern.ReplaceAllString(output, "")
+}
@@ -0,0 +1,26 @@
+package chunker
+
+import "testing"
+
+func TestDropVerbatim(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   string
+	}{
+		{"no placeholders", "- Point one\n- Point two", "- Point one\n- Point two"},
+		{"placeholder line", "- Point one\n[[VERBATIM-1]]\n- Point two", "- Point one\n- Point two"},
+		{"placeholder item", "- Point one\n  - [[VERBATIM-2]]\n- Point two", "- Point one\n- Point two"},
+		{"numbered placeholder item", "1. Step one\n2. `[[VERBATIM-1]]`\n3. Step three", "1. Step one\n3. Step three"},
+		{"inline placeholder", "- The table [[VERBATIM-1]] lists the results", "- The table lists the results"},
+		{"last line", "- Point one\n[[VERBATIM-1]]", "- Point one\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DropVerbatim(tt.output); got != tt.want {
+				t.Errorf("DropVerbatim(%q) = %q, want %q", tt.output, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package chunker
+
+import (
+	"log"
+	"pdf-processor/pkg/tokens"
+	"regexp"
+	"strings"
+)
+
+// clauseBreak is a place where an oversized sentence may be cut. The cut
+// goes after the match, or before it when cutBefore is set.
+type clauseBreak struct {
+	pattern   *regexp.Regexp
+	cutBefore bool
+}
+
+// clauseBreaks are tried in order, from the strongest clause boundary to the
+// weakest, before falling back to hard word limits.
+var clauseBreaks = []clauseBreak{
+	{pattern: regexp.MustCompile(`[;；]\s*`)},
+	{pattern: regexp.MustCompile(`[:：]\s+|：`)},
+	{pattern: regexp.MustCompile(`\s[—–]\s|—`)},
+	{pattern: regexp.MustCompile(`[,，、]\s*`)},
+	{pattern: regexp.MustCompile(`(?i)\s(?:and|but|or|nor|yet|so|because|although|though|whereas|while|which|unless|provided that|und|aber|oder|weil|et|mais|ou|car|y|pero|o|porque)\s`), cutBefore: true},
+}
+
+// splitOversized splits a sentence that exceeds the chunk limits on its own
+// into pieces that fit, cutting at clause boundaries where possible and at
+// hard word (or, for text without spaces, character) limits otherwise. The
+// first piece keeps the sentence's paragraph, section, line and heading
+// marks.
+func splitOversized(s sentence, opts Options) []sentence {
+	texts := splitClauses(s.text, opts, 0)
+	log.Printf("Split oversized sentence of %d words, %d tokens into %d pieces", s.words, s.tokens, len(texts))
+
+	pieces := make([]sentence, len(texts))
+	for i, text := range texts {
+		pieces[i] = sentence{
+			text:           text,
+			words:          wordCount(text),
+			tokens:         tokens.Estimate(text),
+			paragraphStart: i == 0 && s.paragraphStart,
+			sectionStart:   i == 0 && s.sectionStart,
+			lineStart:      i == 0 && s.lineStart,
+			heading:        i == 0 && s.heading,
+		}
+	}
+	return pieces
+}
+
+func fits(text string, opts Options) bool {
+	return !opts.exceeds(wordCount(text), tokens.Estimate(text))
+}
+
+// splitClauses cuts text at the clause boundaries of the given level and
+// packs the resulting segments into pieces that fit. Segments that are still
+// too long are cut at the next level. Since segments are cut next to
+// whitespace or punctuation, their sizes are simply added up.
+func splitClauses(text string, opts Options, level int) []string {
+	if fits(text, opts) {
+		return []string{text}
+	}
+	if level == len(clauseBreaks) {
+		return splitHard(text, opts)
+	}
+
+	var segments []string
+	b := clauseBreaks[level]
+	last := 0
+	for _, m := range b.pattern.FindAllStringIndex(text, -1) {
+		cut := m[1]
+		if b.cutBefore {
+			cut = m[0]
+		}
+		if cut > last && cut < len(text) {
+			segments = append(segments, text[last:cut])
+			last = cut
+		}
+	}
+	segments = append(segments, text[last:])
+
+	var pieces []string
+	var current strings.Builder
+	words, tokenCount := 0, 0
+	flush := func() {
+		if piece := strings.TrimSpace(current.String()); piece != "" {
+			pieces = append(pieces, piece)
+		}
+		current.Reset()
+		words, tokenCount = 0, 0
+	}
+
+	for _, segment := range segments {
+		segmentWords, segmentTokens := wordCount(segment), tokens.Estimate(segment)
+		if current.Len() > 0 && opts.exceeds(words+segmentWords, tokenCount+segmentTokens) {
+			flush()
+		}
+		if opts.exceeds(segmentWords, segmentTokens) {
+			pieces = append(pieces, splitClauses(strings.TrimSpace(segment), opts, level+1)...)
+			continue
+		}
+		current.WriteString(segment)
+		words += segmentWords
+		tokenCount += segmentTokens
+	}
+	flush()
+	return pieces
+}
+
+// splitHard packs words into pieces that fit. A single word that does not
+// fit (text without spaces, long URLs) is split between characters, counting
+// each character on its own, which overestimates the size of Latin text.
+func splitHard(text string, opts Options) []string {
+	var pieces []string
+	var current strings.Builder
+	words, tokenCount := 0, 0
+	flush := func() {
+		if current.Len() > 0 {
+			pieces = append(pieces, current.String())
+		}
+		current.Reset()
+		words, tokenCount = 0, 0
+	}
+
+	previous := ""
+	for _, word := range strings.Fields(text) {
+		wordWords, wordTokens := wordCount(word), tokens.Estimate(word)
+		if current.Len() > 0 && opts.exceeds(words+wordWords, tokenCount+wordTokens) {
+			flush()
+		}
+		if !opts.exceeds(wordWords, wordTokens) {
+			if current.Len() > 0 {
+				current.WriteString(sentenceSeparator(previous, word))
+			}
+			current.WriteString(word)
+			words += wordWords
+			tokenCount += wordTokens
+			previous = word
+			continue
+		}
+
+		for _, r := range word {
+			runeWords, runeTokens := wordCount(string(r)), tokens.Estimate(string(r))
+			if current.Len() > 0 && opts.exceeds(words+runeWords, tokenCount+runeTokens) {
+				flush()
+			}
+			current.WriteRune(r)
+			words += runeWords
+			tokenCount += runeTokens
+		}
+		previous = word
+	}
+	flush()
+	return pieces
+}
@@ -0,0 +1,160 @@
+package chunker
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type paragraphKind int
+
+const (
+	kindText paragraphKind = iota
+	kindHeading
+	kindBreak
+	kindList
+	kindVerbatim
+)
+
+type paragraph struct {
+	kind paragraphKind
+	text string
+}
+
+// sentence is the unit the packer works with. paragraphStart and
+// sectionStart mark the structure the chunk boundaries should follow;
+// lineStart marks a list item or quote line that starts on a new line.
+// A verbatim sentence is a Markdown code block or table.
+type sentence struct {
+	text           string
+	words          int
+	tokens         int
+	paragraphStart bool
+	sectionStart   bool
+	lineStart      bool
+	heading        bool
+	verbatim       bool
+}
+
+var (
+	blankLinePattern       = regexp.MustCompile(`\n[ \t\f\v]*\n`)
+	sceneBreakPattern      = regexp.MustCompile(`^(?:[*~#•·=_-]\s*){1,12}$`)
+	markdownHeadingPattern = regexp.MustCompile(`^#{1,6}\s+\S`)
+	headingWordPattern     = regexp.MustCompile(`(?i)^(?:(?:chapter|part|book|section|appendix)\s+(?:\d+|[ivxlcdm]+|[a-z]|one|two|three|four|five|six|seven|eight|nine|ten|eleven|twelve|thirteen|fourteen|fifteen|sixteen|seventeen|eighteen|nineteen|twenty)\b|(?:prologue|epilogue|preface|foreword|afterword|introduction|conclusion)\W*$)`)
+	numberedPattern        = regexp.MustCompile(`^(?:\d+(?:\.\d+)*\.?|[IVXLC]+\.)\s+\S`)
+)
+
+func parseParagraphs(content string, markdown bool) []paragraph {
+	if markdown {
+		return splitMarkdown(content)
+	}
+	return splitIntoParagraphs(content)
+}
+
+// splitIntoParagraphs splits text on blank lines. Single line breaks inside
+// a paragraph are treated as wrapping and joined with spaces, except that
+// heading lines at the top of a block become paragraphs of their own.
+func splitIntoParagraphs(content string) []paragraph {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	content = strings.ReplaceAll(content, "\r", "\n")
+
+	var paragraphs []paragraph
+	for _, block := range blankLinePattern.Split(content, -1) {
+		var lines []string
+		for _, line := range strings.Split(block, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				lines = append(lines, line)
+			}
+		}
+		paragraphs = append(paragraphs, blockParagraphs(lines)...)
+	}
+	return paragraphs
+}
+
+// blockParagraphs turns the non-empty, trimmed lines of one block of text
+// between blank lines into paragraphs.
+func blockParagraphs(lines []string) []paragraph {
+	if len(lines) == 0 {
+		return nil
+	}
+	if len(lines) == 1 && sceneBreakPattern.MatchString(lines[0]) {
+		return []paragraph{{kind: kindBreak, text: lines[0]}}
+	}
+
+	var paragraphs []paragraph
+	for len(lines) > 0 && isHeading(lines[0], len(lines) == 1) {
+		paragraphs = append(paragraphs, paragraph{kind: kindHeading, text: lines[0]})
+		lines = lines[1:]
+	}
+	if len(lines) == 0 {
+		return paragraphs
+	}
+
+	var text strings.Builder
+	text.WriteString(lines[0])
+	for i, line := range lines[1:] {
+		text.WriteString(sentenceSeparator(lines[i], line))
+		text.WriteString(line)
+	}
+	return append(paragraphs, paragraph{kind: kindText, text: text.String()})
+}
+
+// isHeading decides whether a line is a heading. A line that stands alone
+// between blank lines only needs to be short and unpunctuated; a line that
+// is followed by more text must also look like a heading (markdown, a
+// chapter keyword, numbering, or all capitals) so that wrapped prose is not
+// mistaken for one.
+func isHeading(line string, standalone bool) bool {
+	if markdownHeadingPattern.MatchString(line) {
+		return true
+	}
+
+	words := strings.Fields(line)
+	if len(words) == 0 || len(words) > 12 || len(line) > 80 {
+		return false
+	}
+
+	last, _ := utf8.DecodeLastRuneInString(line)
+	if strings.ContainsRune(",;:", last) {
+		return false
+	}
+
+	keyword := headingWordPattern.MatchString(line)
+	if (isTerminator(last) || isCloser(last)) && !keyword {
+		return false
+	}
+
+	if keyword || isUpper(line) {
+		return true
+	}
+	if numberedPattern.MatchString(line) && len(words) <= 8 {
+		return true
+	}
+	return standalone && startsUpper(line)
+}
+
+func isUpper(s string) bool {
+	letters := 0
+	for _, r := range s {
+		if unicode.IsLetter(r) {
+			if !unicode.IsUpper(r) {
+				return false
+			}
+			letters++
+		}
+	}
+	return letters >= 2
+}
+
+func startsUpper(s string) bool {
+	for _, r := range s {
+		if unicode.IsLetter(r) {
+			return unicode.IsUpper(r) || !unicode.IsLower(r)
+		}
+		if unicode.IsDigit(r) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package chunker
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Sentence terminators, following the STerm and ATerm classes of UAX #29.
+// Spaced terminators only end a sentence when followed by whitespace or the
+// end of the text; unspaced ones belong to scripts written without spaces
+// between sentences and end a sentence immediately.
+var (
+	spacedTerminators   = ".…!?‼⁇⁈⁉‽।॥؟۔܀܁܂።፧፨᙮᠃᠉៕។"
+	unspacedTerminators = "。！？｡．︒﹒﹖﹗"
+	closers             = "\"'”’»«›‹)]}」』》〉】〕〗〙〛）］｝〞〟"
+)
+
+func isTerminator(r rune) bool {
+	return strings.ContainsRune(spacedTerminators, r) || strings.ContainsRune(unspacedTerminators, r)
+}
+
+func isCloser(r rune) bool {
+	return strings.ContainsRune(closers, r) || unicode.Is(unicode.Pe, r) || unicode.Is(unicode.Pf, r)
+}
+
+// splitIntoSentences segments text into sentences rune by rune. Each run of
+// terminators, together with any closing quotes or brackets after it, is a
+// candidate boundary that boundaryRules accept or reject. The text itself is
+// never modified, so abbreviations reach the model exactly as written.
+func splitIntoSentences(text string, abbreviations *Abbreviations) []string {
+	runes := []rune(text)
+
+	var sentences []string
+	start := 0
+	for i := 0; i < len(runes); i++ {
+		if !isTerminator(runes[i]) {
+			continue
+		}
+
+		end := i + 1
+		for end < len(runes) && isTerminator(runes[end]) {
+			end++
+		}
+		for end < len(runes) && isCloser(runes[end]) {
+			end++
+		}
+
+		if isSentenceBoundary(runes, start, i, end, abbreviations) {
+			sentences = appendSentence(sentences, runes[start:end])
+			start = end
+		}
+		i = end - 1
+	}
+	sentences = appendSentence(sentences, runes[start:])
+
+	return sentences
+}
+
+func appendSentence(sentences []string, runes []rune) []string {
+	sentence := strings.TrimSpace(string(runes))
+	if sentence == "" {
+		return sentences
+	}
+	return append(sentences, sentence)
+}
+
+// wordCount counts whitespace-separated words, counting each ideograph or
+// kana as a word of its own since CJK text has no spaces between words.
+func wordCount(text string) int {
+	count := 0
+	inWord := false
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Han, r), unicode.Is(unicode.Hiragana, r), unicode.Is(unicode.Katakana, r):
+			count++
+			inWord = false
+		case unicode.IsSpace(r):
+			inWord = false
+		case unicode.IsLetter(r), unicode.IsNumber(r):
+			if !inWord {
+				count++
+				inWord = true
+			}
+		}
+	}
+	return count
+}
+
+// WordCount counts words the way the chunker does, so that sizes and ratios
+// also hold for CJK text.
+func WordCount(text string) int {
+	return wordCount(text)
+}
+
+// sentenceSeparator is the text placed between two sentences of the same
+// paragraph: a space, except between sentences of scripts written without
+// spaces.
+func sentenceSeparator(prev, next string) string {
+	last, _ := utf8.DecodeLastRuneInString(prev)
+	first, _ := utf8.DecodeRuneInString(next)
+	if isUnspacedScript(last) && isUnspacedScript(first) {
+		return ""
+	}
+	return " "
+}
+
+func isUnspacedScript(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) ||
+		(r >= 0x3000 && r <= 0x303F) || (r >= 0xFF00 && r <= 0xFFEF)
+}
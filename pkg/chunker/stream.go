@@ -0,0 +1,147 @@
+package chunker
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"iter"
+	"log"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// maxLineBytes bounds how much of a single line is buffered. Longer
+	// lines, as in text dumps without line breaks, are cut at a space.
+	maxLineBytes = 1 << 20
+	// maxBlockBytes bounds how much of a paragraph is buffered before it is
+	// chunked; a longer paragraph is treated as several.
+	maxBlockBytes = 4 << 20
+)
+
+// StreamChunks reads text from r and yields each chunk as soon as it is
+// complete, so that memory use is bounded by the size of a paragraph and a
+// chunk rather than the whole input. Chunks are packed greedily whatever
+// opts.Strategy says, since balancing needs the whole text, and chapters are
+// not detected. A read error is yielded once and ends the sequence.
+func StreamChunks(r io.Reader, opts Options) iter.Seq2[Chunk, error] {
+	return func(yield func(Chunk, error) bool) {
+		if err := opts.validate(); err != nil {
+			yield(Chunk{}, err)
+			return
+		}
+		if opts.Strategy == StrategyBalanced {
+			log.Println("Balanced chunking needs the whole text, streaming with greedy packing")
+		}
+		log.Printf("Starting streaming chunking with chunk size %d words, %d tokens", opts.ChunkSize, opts.ChunkTokens)
+
+		p := &packer{opts: opts}
+		var previous []sentence
+		count := 0
+		emit := func(group []sentence) bool {
+			if group == nil {
+				return true
+			}
+			chunk := newChunk(group)
+			if previous != nil && opts.Overlap > 0 {
+				chunk.Context = renderSentences(overlapSentences(previous, opts.Overlap))
+			}
+			previous = group
+			count++
+			return yield(chunk, nil)
+		}
+
+		addParagraphs := func(paragraphs []paragraph) bool {
+			for _, para := range paragraphs {
+				for _, s := range appendSentences(nil, para, opts) {
+					for _, group := range p.add(s) {
+						if !emit(group) {
+							return false
+						}
+					}
+				}
+			}
+			return true
+		}
+
+		markdown := &markdownParser{kind: blockNone}
+		var block []string
+		blockBytes := 0
+		flushBlock := func() bool {
+			if opts.Markdown {
+				return addParagraphs(markdown.flush())
+			}
+			ok := addParagraphs(blockParagraphs(block))
+			block, blockBytes = block[:0], 0
+			return ok
+		}
+
+		reader := bufio.NewReaderSize(r, 64*1024)
+		var line []byte
+		for {
+			fragment, err := reader.ReadSlice('\n')
+			line = append(line, fragment...)
+			if err == bufio.ErrBufferFull && len(line) < maxLineBytes {
+				continue
+			}
+			if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+				log.Printf("Failed to read text stream: %v", err)
+				yield(Chunk{}, err)
+				return
+			}
+
+			var rest []byte
+			if err == bufio.ErrBufferFull {
+				line, rest = cutLongLine(line)
+			}
+
+			text := strings.TrimSuffix(strings.TrimSuffix(string(line), "\n"), "\r")
+			for _, l := range strings.Split(text, "\r") {
+				if opts.Markdown {
+					if !addParagraphs(markdown.line(l)) {
+						return
+					}
+					continue
+				}
+				if l = strings.TrimSpace(l); l == "" {
+					if !flushBlock() {
+						return
+					}
+					continue
+				}
+				block = append(block, l)
+				blockBytes += len(l)
+			}
+			if blockBytes > maxBlockBytes && !flushBlock() {
+				return
+			}
+
+			line = append(line[:0], rest...)
+			if err == io.EOF {
+				break
+			}
+		}
+
+		if !flushBlock() || !emit(p.flush()) {
+			return
+		}
+		log.Printf("Streamed %d chunks", count)
+	}
+}
+
+// cutLongLine splits an overlong line after its last space, or at the last
+// character boundary if it has none, and returns the remainder separately.
+func cutLongLine(line []byte) (head, rest []byte) {
+	i := bytes.LastIndexAny(line, " \t")
+	if i <= 0 {
+		// No space: cut before the last, possibly incomplete, character.
+		i = len(line) - 1
+		for i > 0 && !utf8.RuneStart(line[i]) {
+			i--
+		}
+	}
+	if i <= 0 {
+		return line, nil
+	}
+	return line[:i], append([]byte(nil), line[i:]...)
+}
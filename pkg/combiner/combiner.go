@@ -0,0 +1,246 @@
+package combiner
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type Mode string
+
+const (
+	ModeProse      Mode = "prose"
+	ModeNotes      Mode = "notes"
+	ModeOutline    Mode = "outline"
+	ModeFlashcards Mode = "flashcards"
+)
+
+var bulletPattern = regexp.MustCompile(`^(\s*)(?:[-*+•]|\d+[.)])\s+(.*)$`)
+
+func ParseMode(s string) (Mode, error) {
+	switch Mode(strings.ToLower(strings.TrimSpace(s))) {
+	case "", ModeProse:
+		return ModeProse, nil
+	case ModeNotes:
+		return ModeNotes, nil
+	case ModeOutline:
+		return ModeOutline, nil
+	case ModeFlashcards:
+		return ModeFlashcards, nil
+	}
+	return "", fmt.Errorf("unknown output mode %q", s)
+}
+
+// Template is the prompt template used for the mode when the request does
+// not name one explicitly. Prose uses the registry default.
+func (m Mode) Template() string {
+	if m == ModeProse {
+		return ""
+	}
+	return string(m)
+}
+
+// Fits reports whether a prompt template declared for the given mode
+// writes output in the shape this mode combines. Templates that declare no
+// mode write prose.
+func (m Mode) Fits(templateMode string) bool {
+	if templateMode == "" {
+		templateMode = string(ModeProse)
+	}
+	return Mode(templateMode) == m
+}
+
+func (m Mode) ContentType() string {
+	switch m {
+	case ModeNotes, ModeOutline:
+		return "text/markdown; charset=utf-8"
+	case ModeFlashcards:
+		return "text/tab-separated-values; charset=utf-8"
+	}
+	return "text/plain"
+}
+
+func (m Mode) Filename() string {
+	switch m {
+	case ModeNotes:
+		return "notes.md"
+	case ModeOutline:
+		return "outline.md"
+	case ModeFlashcards:
+		return "flashcards.tsv"
+	}
+	return "processed.txt"
+}
+
+// AddTitle puts the document title at the top of a combined document, as a
+// heading in the Markdown formats and as a plain line in plain text.
+// Flashcard files have no room for a title and are returned unchanged.
+func AddTitle(mode Mode, markdown bool, title, combined string) string {
+	switch {
+	case title == "" || mode == ModeFlashcards:
+		return combined
+	case mode == ModeNotes || mode == ModeOutline || markdown:
+		return "# " + title + "\n\n" + combined
+	}
+	return title + "\n\n" + combined
+}
+
+// Section is a titled group of chunk outputs, typically a chapter. An
+// untitled section is rendered without a heading. Level is the level of the
+// chapter's heading in Markdown input; prose output then renders the title
+// as a Markdown heading of that level.
+type Section struct {
+	Title string
+	Level int
+	Parts []string
+}
+
+// Combine assembles the per-chunk outputs of a job into a single document
+// in the shape of the mode. Empty parts (failed chunks) are skipped. When
+// the chunks were sent with overlap sentences of context, material repeated
+// across chunk seams is trimmed.
+func Combine(mode Mode, sections []Section, overlap int) string {
+	if overlap > 0 {
+		sections = trimSeams(mode, sections)
+	}
+
+	var parts []string
+	for _, section := range sections {
+		parts = append(parts, section.Parts...)
+	}
+	log.Printf("Combining %d result chunks in %d sections in %s mode", len(parts), len(sections), mode)
+
+	var combined string
+	switch mode {
+	case ModeNotes:
+		combined = combineNotes(sections)
+	case ModeOutline:
+		combined = combineOutline(sections)
+	case ModeFlashcards:
+		cards := ParseFlashcards(parts)
+		log.Printf("Parsed %d flashcards", len(cards))
+		combined = FlashcardsTSV(cards)
+	default:
+		combined = combineProse(sections)
+	}
+
+	log.Printf("Combined %d chunks into %d words total", len(parts), len(strings.Fields(combined)))
+	return combined
+}
+
+// combineProse keeps the paragraphs and headings of each part and separates
+// parts with a blank line, so chunk seams look like paragraph breaks.
+func combineProse(sections []Section) string {
+	var final strings.Builder
+	for _, section := range sections {
+		if section.Title != "" {
+			if section.Level > 0 {
+				final.WriteString(strings.Repeat("#", section.Level) + " ")
+			}
+			final.WriteString(section.Title)
+			final.WriteString("\n\n")
+		}
+		for _, part := range section.Parts {
+			final.WriteString(strings.TrimSpace(part))
+			final.WriteString("\n\n")
+		}
+	}
+	return final.String()
+}
+
+func combineNotes(sections []Section) string {
+	var final strings.Builder
+	for _, section := range sections {
+		if section.Title != "" {
+			final.WriteString("## ")
+			final.WriteString(section.Title)
+			final.WriteString("\n\n")
+		}
+		for _, part := range section.Parts {
+			lines := bulletLines(part)
+			if len(lines) == 0 {
+				continue
+			}
+			for _, line := range lines {
+				final.WriteString(strings.Repeat("  ", line.depth))
+				final.WriteString("- ")
+				final.WriteString(line.text)
+				final.WriteString("\n")
+			}
+			final.WriteString("\n")
+		}
+	}
+	return final.String()
+}
+
+// combineOutline numbers top-level outline entries across all chunks so the
+// combined outline reads as one continuous list of sections. A titled
+// section becomes a numbered entry of its own with the chunk outlines
+// nested beneath it.
+func combineOutline(sections []Section) string {
+	var final strings.Builder
+	number := 0
+	for _, section := range sections {
+		offset := 0
+		if section.Title != "" {
+			number++
+			final.WriteString(strconv.Itoa(number))
+			final.WriteString(". ")
+			final.WriteString(section.Title)
+			final.WriteString("\n")
+			offset = 1
+		}
+		for _, part := range section.Parts {
+			for _, line := range bulletLines(part) {
+				depth := line.depth + offset
+				if depth == 0 {
+					number++
+					final.WriteString(strconv.Itoa(number))
+					final.WriteString(". ")
+					final.WriteString(line.text)
+					final.WriteString("\n")
+					continue
+				}
+				final.WriteString(strings.Repeat("   ", depth))
+				final.WriteString("- ")
+				final.WriteString(line.text)
+				final.WriteString("\n")
+			}
+		}
+	}
+	return final.String()
+}
+
+type bulletLine struct {
+	depth int
+	text  string
+}
+
+// bulletLines normalises a model-written list: any bullet or number marker
+// becomes a plain item, indentation becomes a depth relative to the
+// shallowest item, and lines that are not list items are dropped.
+func bulletLines(part string) []bulletLine {
+	var lines []bulletLine
+	var indents []int
+	for _, raw := range strings.Split(strings.ReplaceAll(part, "\t", "    "), "\n") {
+		match := bulletPattern.FindStringSubmatch(raw)
+		if match == nil {
+			continue
+		}
+		text := strings.TrimSpace(match[2])
+		if text == "" {
+			continue
+		}
+
+		indent := len(match[1])
+		depth := 0
+		for depth < len(indents) && indents[depth] < indent {
+			depth++
+		}
+		indents = append(indents[:depth], indent)
+		lines = append(lines, bulletLine{depth: depth, text: text})
+	}
+	return lines
+}
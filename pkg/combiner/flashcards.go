@@ -0,0 +1,92 @@
+package combiner
+
+import "strings"
+
+type Flashcard struct {
+	Front string `json:"front"`
+	Back  string `json:"back"`
+}
+
+// ParseFlashcards reads "Q: ... / A: ..." pairs from the chunk outputs.
+// Continuation lines are appended to the current question or answer, and
+// cards whose question was already seen are dropped.
+func ParseFlashcards(parts []string) []Flashcard {
+	var cards []Flashcard
+	seen := make(map[string]bool)
+
+	for _, part := range parts {
+		var current Flashcard
+		field := ""
+
+		flush := func() {
+			current.Front = strings.TrimSpace(current.Front)
+			current.Back = strings.TrimSpace(current.Back)
+			key := strings.ToLower(current.Front)
+			if current.Front != "" && current.Back != "" && !seen[key] {
+				seen[key] = true
+				cards = append(cards, current)
+			}
+			current = Flashcard{}
+			field = ""
+		}
+
+		for _, line := range strings.Split(part, "\n") {
+			line = strings.TrimSpace(line)
+			switch {
+			case hasLabel(line, "Q"):
+				flush()
+				current.Front = trimLabel(line)
+				field = "Q"
+			case hasLabel(line, "A"):
+				current.Back = trimLabel(line)
+				field = "A"
+			case line == "":
+				if field == "A" {
+					flush()
+				}
+			case field == "Q":
+				current.Front += " " + line
+			case field == "A":
+				current.Back += " " + line
+			}
+		}
+		flush()
+	}
+	return cards
+}
+
+func hasLabel(line, label string) bool {
+	line = strings.TrimLeft(line, "*-# ")
+	return strings.HasPrefix(line, label+":") || strings.HasPrefix(line, label+"**:") || strings.HasPrefix(line, label+":**")
+}
+
+func trimLabel(line string) string {
+	line = strings.TrimLeft(line, "*-# ")
+	_, rest, _ := strings.Cut(line, ":")
+	return strings.TrimSpace(strings.TrimLeft(rest, "* "))
+}
+
+// FlashcardsTSV renders cards as an Anki-compatible import file: one note per
+// line with the front and back separated by a tab. The header lines tell Anki
+// about the separator and that fields may contain HTML line breaks.
+func FlashcardsTSV(cards []Flashcard) string {
+	var tsv strings.Builder
+	tsv.WriteString("#separator:tab\n#html:true\n")
+	for _, card := range cards {
+		tsv.WriteString(tsvField(card.Front))
+		tsv.WriteString("\t")
+		tsv.WriteString(tsvField(card.Back))
+		tsv.WriteString("\n")
+	}
+	return tsv.String()
+}
+
+func tsvField(s string) string {
+	s = strings.ReplaceAll(s, "&", "&amp;")
+	s = strings.ReplaceAll(s, "<", "&lt;")
+	s = strings.ReplaceAll(s, ">", "&gt;")
+	s = strings.ReplaceAll(s, "\t", " ")
+	s = strings.ReplaceAll(s, "\r\n", "<br>")
+	s = strings.ReplaceAll(s, "\n", "<br>")
+	return s
+}
@@ -0,0 +1,141 @@
+package combiner
+
+import (
+	"log"
+	"strings"
+	"unicode"
+)
+
+// seamWindow is how many sentences or list items at the end of one part and
+// the start of the next are compared when trimming a seam.
+const seamWindow = 3
+
+type span struct {
+	start, end int
+}
+
+// trimSeams removes sentences or list items at the start of a part that
+// repeat the end of the previous part in the same section. With overlapping
+// chunks the model sometimes restates the context it was given; trimming
+// keeps events at a seam from appearing twice.
+func trimSeams(mode Mode, sections []Section) []Section {
+	if mode == ModeFlashcards {
+		// ParseFlashcards already drops repeated questions.
+		return sections
+	}
+
+	trimmed := make([]Section, len(sections))
+	for i, section := range sections {
+		trimmed[i] = Section{Title: section.Title, Level: section.Level}
+		for j, part := range section.Parts {
+			if j > 0 {
+				part = trimSeam(mode, section.Parts[j-1], part)
+			}
+			trimmed[i].Parts = append(trimmed[i].Parts, part)
+		}
+	}
+	return trimmed
+}
+
+func trimSeam(mode Mode, prev, next string) string {
+	prevSpans := seamSpans(mode, prev)
+	nextSpans := seamSpans(mode, next)
+	tail := prevSpans[max(0, len(prevSpans)-seamWindow):]
+
+	drop := 0
+	for drop < len(nextSpans) && drop < seamWindow {
+		unit := seamKey(mode, next[nextSpans[drop].start:nextSpans[drop].end])
+		repeated := false
+		for _, s := range tail {
+			if similar(unit, seamKey(mode, prev[s.start:s.end])) {
+				repeated = true
+				break
+			}
+		}
+		if !repeated {
+			break
+		}
+		drop++
+	}
+
+	if drop == 0 {
+		return next
+	}
+	log.Printf("Trimmed %d repeated units at a chunk seam", drop)
+	if drop == len(nextSpans) {
+		return ""
+	}
+	return next[nextSpans[drop].start:]
+}
+
+// seamSpans splits a part into list items (one per line) for the list modes
+// and into sentences for prose.
+func seamSpans(mode Mode, part string) []span {
+	var spans []span
+	if mode == ModeNotes || mode == ModeOutline {
+		start := 0
+		for start < len(part) {
+			end := strings.IndexByte(part[start:], '\n')
+			if end < 0 {
+				end = len(part)
+			} else {
+				end += start
+			}
+			if strings.TrimSpace(part[start:end]) != "" {
+				spans = append(spans, span{start, end})
+			}
+			start = end + 1
+		}
+		return spans
+	}
+
+	start := -1
+	runes := []rune(part)
+	offset := 0
+	for i, r := range runes {
+		if start < 0 && !unicode.IsSpace(r) {
+			start = offset
+		}
+		offset += len(string(r))
+		atEnd := i+1 == len(runes) || unicode.IsSpace(runes[i+1])
+		if start >= 0 && strings.ContainsRune(".!?…。！？", r) && atEnd {
+			spans = append(spans, span{start, offset})
+			start = -1
+		}
+	}
+	if start >= 0 && strings.TrimSpace(part[start:]) != "" {
+		spans = append(spans, span{start, len(part)})
+	}
+	return spans
+}
+
+// seamKey is the set of words of a unit, with any list marker removed.
+func seamKey(mode Mode, unit string) map[string]bool {
+	if mode == ModeNotes || mode == ModeOutline {
+		if match := bulletPattern.FindStringSubmatch(unit); match != nil {
+			unit = match[2]
+		}
+	}
+
+	words := make(map[string]bool)
+	for _, word := range strings.FieldsFunc(strings.ToLower(unit), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}) {
+		words[word] = true
+	}
+	return words
+}
+
+// similar reports whether two units share at least 80% of their words.
+func similar(a, b map[string]bool) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return false
+	}
+	shared := 0
+	for word := range a {
+		if b[word] {
+			shared++
+		}
+	}
+	return float64(shared)/float64(len(a)+len(b)-shared) >= 0.8
+}
@@ -10,11 +10,21 @@ import (
 )
 
 type Config struct {
-	Port           string
-	OpenRouterKey  string
-	MaxConcurrent  int
-	RequestTimeout time.Duration
-	ChunkSize      int
+	Port             string
+	OpenRouterKey    string
+	Model            string
+	MaxConcurrent    int
+	RequestTimeout   time.Duration
+	ChunkSize        int
+	ChunkTokens      int
+	ChunkStrategy    string
+	ChunkOverlap     int
+	PromptDir        string
+	AbbreviationsDir string
+	MaxUploadBytes   int64
+
+	ReadabilityTolerance float64
+	ReadabilityRetries   int
 }
 
 func Load() *Config {
@@ -36,21 +46,60 @@ func Load() *Config {
 		log.Printf("OPENROUTER_API_KEY: [REDACTED]")
 	}
 
+	model := getEnv("MODEL", "gemini-2.0-flash")
+	log.Printf("MODEL: %s", model)
+
 	maxConcurrent := getEnvAsInt("MAX_CONCURRENT", 10)
 	log.Printf("MAX_CONCURRENT: %d", maxConcurrent)
 
 	requestTimeout := getEnvAsDuration("REQUEST_TIMEOUT", 30*time.Second)
 	log.Printf("REQUEST_TIMEOUT: %v", requestTimeout)
 
-	chunkSize := getEnvAsInt("CHUNK_SIZE", 900)
+	// CHUNK_SIZE optionally caps chunks in words; CHUNK_TOKENS caps the token
+	// budget derived from the model's context window.
+	chunkSize := getEnvAsInt("CHUNK_SIZE", 0)
 	log.Printf("CHUNK_SIZE: %d", chunkSize)
 
+	chunkTokens := getEnvAsInt("CHUNK_TOKENS", 1200)
+	log.Printf("CHUNK_TOKENS: %d", chunkTokens)
+
+	chunkStrategy := getEnv("CHUNK_STRATEGY", "greedy")
+	log.Printf("CHUNK_STRATEGY: %s", chunkStrategy)
+
+	chunkOverlap := getEnvAsInt("CHUNK_OVERLAP", 0)
+	log.Printf("CHUNK_OVERLAP: %d sentences", chunkOverlap)
+
+	promptDir := getEnv("PROMPT_DIR", "")
+	log.Printf("PROMPT_DIR: %s", promptDir)
+
+	abbreviationsDir := getEnv("ABBREVIATIONS_DIR", "")
+	log.Printf("ABBREVIATIONS_DIR: %s", abbreviationsDir)
+
+	maxUploadMB := getEnvAsInt("MAX_UPLOAD_MB", 32)
+	log.Printf("MAX_UPLOAD_MB: %d", maxUploadMB)
+
+	readabilityTolerance := getEnvAsFloat("READABILITY_TOLERANCE", 1.5)
+	log.Printf("READABILITY_TOLERANCE: %.1f", readabilityTolerance)
+
+	readabilityRetries := getEnvAsInt("READABILITY_RETRIES", 1)
+	log.Printf("READABILITY_RETRIES: %d", readabilityRetries)
+
 	return &Config{
-		Port:           port,
-		OpenRouterKey:  apiKey,
-		MaxConcurrent:  maxConcurrent,
-		RequestTimeout: requestTimeout,
-		ChunkSize:      chunkSize,
+		Port:             port,
+		OpenRouterKey:    apiKey,
+		Model:            model,
+		MaxConcurrent:    maxConcurrent,
+		RequestTimeout:   requestTimeout,
+		ChunkSize:        chunkSize,
+		ChunkTokens:      chunkTokens,
+		ChunkStrategy:    chunkStrategy,
+		ChunkOverlap:     chunkOverlap,
+		PromptDir:        promptDir,
+		AbbreviationsDir: abbreviationsDir,
+		MaxUploadBytes:   int64(maxUploadMB) << 20,
+
+		ReadabilityTolerance: readabilityTolerance,
+		ReadabilityRetries:   readabilityRetries,
 	}
 }
 
@@ -77,6 +126,20 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return value
 }
 
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	valueStr := getEnv(key, "")
+	if valueStr == "" {
+		return defaultValue
+	}
+
+	value, err := strconv.ParseFloat(valueStr, 64)
+	if err != nil {
+		log.Printf("Failed to parse %s as float: %v, using default: %v", key, err, defaultValue)
+		return defaultValue
+	}
+	return value
+}
+
 func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
 	valueStr := getEnv(key, "")
 	if valueStr == "" {
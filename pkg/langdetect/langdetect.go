@@ -0,0 +1,212 @@
+package langdetect
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+type Language struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+type Result struct {
+	Language
+	Confidence float64 `json:"confidence"`
+}
+
+var Unknown = Language{Code: "und", Name: "the same language as the input text"}
+
+var languages = map[string]Language{
+	"ar": {"ar", "Arabic"},
+	"de": {"de", "German"},
+	"el": {"el", "Greek"},
+	"en": {"en", "English"},
+	"es": {"es", "Spanish"},
+	"fa": {"fa", "Persian"},
+	"fr": {"fr", "French"},
+	"he": {"he", "Hebrew"},
+	"hi": {"hi", "Hindi"},
+	"it": {"it", "Italian"},
+	"ja": {"ja", "Japanese"},
+	"ko": {"ko", "Korean"},
+	"nl": {"nl", "Dutch"},
+	"pl": {"pl", "Polish"},
+	"pt": {"pt", "Portuguese"},
+	"ru": {"ru", "Russian"},
+	"sv": {"sv", "Swedish"},
+	"th": {"th", "Thai"},
+	"tr": {"tr", "Turkish"},
+	"uk": {"uk", "Ukrainian"},
+	"zh": {"zh", "Chinese"},
+}
+
+// Word n-gram profiles for languages written in scripts shared by several
+// languages. Each profile lists the most frequent short words, which are
+// enough to tell the languages apart on a few sentences of running text.
+var profiles = map[string][]string{
+	"en": {"the", "and", "of", "to", "in", "is", "that", "it", "was", "for", "with", "as", "he", "she", "on", "his", "her", "be", "at", "by", "this", "had", "not", "are", "but", "from", "they", "you", "which", "have"},
+	"de": {"der", "die", "und", "das", "ist", "nicht", "ein", "eine", "zu", "den", "von", "mit", "sich", "des", "auf", "für", "dem", "im", "auch", "es", "sie", "er", "ich", "wir", "aber", "wie", "noch", "nach", "bei", "wird"},
+	"fr": {"le", "la", "les", "de", "des", "et", "est", "un", "une", "du", "que", "qui", "dans", "pour", "pas", "au", "sur", "ne", "il", "elle", "se", "ce", "avec", "plus", "par", "sont", "mais", "ou", "nous", "vous"},
+	"es": {"el", "la", "los", "las", "de", "y", "que", "en", "un", "una", "es", "por", "con", "para", "del", "se", "no", "su", "al", "lo", "como", "más", "pero", "sus", "le", "ya", "muy", "fue", "este", "está"},
+	"it": {"il", "la", "di", "che", "e", "è", "un", "una", "per", "non", "in", "del", "della", "le", "con", "si", "lo", "gli", "da", "sono", "come", "ma", "anche", "alla", "nel", "più", "questo", "dei", "al", "era"},
+	"pt": {"o", "a", "os", "as", "de", "que", "e", "do", "da", "em", "um", "uma", "para", "com", "não", "é", "no", "na", "se", "por", "mais", "dos", "das", "como", "mas", "ao", "ele", "ela", "foi", "são"},
+	"nl": {"de", "het", "een", "en", "van", "is", "dat", "niet", "op", "te", "zijn", "met", "voor", "ik", "je", "die", "er", "aan", "ook", "als", "maar", "om", "bij", "wordt", "naar", "hij", "zij", "nog", "was", "dit"},
+	"sv": {"och", "att", "det", "som", "en", "är", "på", "av", "för", "med", "till", "den", "har", "inte", "om", "ett", "jag", "var", "men", "de", "sig", "så", "kan", "från", "vi", "han", "hon", "eller", "när", "ska"},
+	"pl": {"i", "w", "nie", "na", "się", "z", "to", "że", "do", "jest", "jak", "co", "ale", "po", "o", "tak", "za", "od", "był", "przez", "dla", "czy", "już", "jego", "jej", "może", "są", "tym", "oraz", "które"},
+	"tr": {"ve", "bir", "bu", "da", "de", "için", "ile", "çok", "ne", "o", "gibi", "daha", "ama", "olarak", "var", "en", "kadar", "sonra", "değil", "mi", "her", "ben", "sen", "onun", "olan", "ya", "şey", "diye", "hem", "çünkü"},
+	"ru": {"и", "в", "не", "на", "что", "с", "он", "как", "это", "по", "но", "к", "она", "из", "у", "за", "от", "то", "так", "же", "его", "все", "был", "было", "только", "о", "мы", "они", "или", "для"},
+	"uk": {"і", "в", "не", "на", "що", "з", "він", "як", "це", "по", "але", "до", "вона", "із", "у", "за", "від", "та", "так", "же", "його", "все", "був", "було", "тільки", "про", "ми", "вони", "або", "для"},
+}
+
+// Detect guesses the language of text offline. Scripts used by a single
+// language decide directly; Latin and Cyrillic text is scored against the
+// word profiles above.
+func Detect(text string) Result {
+	sample := text
+	if len(sample) > 20000 {
+		sample = sample[:20000]
+	}
+
+	scripts := make(map[string]int)
+	letters := 0
+	for _, r := range sample {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		scripts[scriptOf(r)]++
+	}
+	if letters == 0 {
+		log.Println("Language detection: no letters in sample")
+		return Result{Language: Unknown}
+	}
+
+	dominant, count := "", 0
+	for script, n := range scripts {
+		if n > count {
+			dominant, count = script, n
+		}
+	}
+	share := float64(count) / float64(letters)
+
+	var result Result
+	switch dominant {
+	case "Han", "Kana":
+		if scripts["Kana"] > 0 && float64(scripts["Kana"])/float64(letters) > 0.05 {
+			result = Result{Language: languages["ja"], Confidence: share}
+		} else {
+			result = Result{Language: languages["zh"], Confidence: share}
+		}
+	case "Hangul":
+		result = Result{Language: languages["ko"], Confidence: share}
+	case "Arabic":
+		if strings.ContainsAny(sample, "پچژگ") {
+			result = Result{Language: languages["fa"], Confidence: share}
+		} else {
+			result = Result{Language: languages["ar"], Confidence: share}
+		}
+	case "Devanagari":
+		result = Result{Language: languages["hi"], Confidence: share}
+	case "Greek":
+		result = Result{Language: languages["el"], Confidence: share}
+	case "Hebrew":
+		result = Result{Language: languages["he"], Confidence: share}
+	case "Thai":
+		result = Result{Language: languages["th"], Confidence: share}
+	case "Cyrillic":
+		result = scoreProfiles(sample, []string{"ru", "uk"})
+	case "Latin":
+		result = scoreProfiles(sample, []string{"en", "de", "fr", "es", "it", "pt", "nl", "sv", "pl", "tr"})
+	default:
+		result = Result{Language: Unknown}
+	}
+
+	log.Printf("Detected language %s (%s), confidence %.2f", result.Code, result.Name, result.Confidence)
+	return result
+}
+
+func scoreProfiles(sample string, candidates []string) Result {
+	counts := make(map[string]int)
+	total := 0
+	for _, word := range strings.FieldsFunc(strings.ToLower(sample), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	}) {
+		counts[word]++
+		total++
+	}
+	if total == 0 {
+		return Result{Language: Unknown}
+	}
+
+	type score struct {
+		code string
+		hits int
+	}
+	scores := make([]score, 0, len(candidates))
+	for _, code := range candidates {
+		hits := 0
+		for _, word := range profiles[code] {
+			hits += counts[word]
+		}
+		scores = append(scores, score{code, hits})
+	}
+	sort.SliceStable(scores, func(i, j int) bool { return scores[i].hits > scores[j].hits })
+
+	best := scores[0]
+	if best.hits == 0 {
+		return Result{Language: Unknown}
+	}
+
+	// Confidence is the margin over the runner-up, so closely related
+	// languages sharing many function words score low.
+	confidence := 1.0
+	if len(scores) > 1 {
+		confidence = float64(best.hits-scores[1].hits) / float64(best.hits)
+	}
+	return Result{Language: languages[best.code], Confidence: confidence}
+}
+
+func scriptOf(r rune) string {
+	switch {
+	case unicode.Is(unicode.Latin, r):
+		return "Latin"
+	case unicode.Is(unicode.Cyrillic, r):
+		return "Cyrillic"
+	case unicode.Is(unicode.Han, r):
+		return "Han"
+	case unicode.Is(unicode.Hiragana, r), unicode.Is(unicode.Katakana, r):
+		return "Kana"
+	case unicode.Is(unicode.Hangul, r):
+		return "Hangul"
+	case unicode.Is(unicode.Arabic, r):
+		return "Arabic"
+	case unicode.Is(unicode.Devanagari, r):
+		return "Devanagari"
+	case unicode.Is(unicode.Greek, r):
+		return "Greek"
+	case unicode.Is(unicode.Hebrew, r):
+		return "Hebrew"
+	case unicode.Is(unicode.Thai, r):
+		return "Thai"
+	}
+	return "Other"
+}
+
+// Lookup resolves a language given as an ISO 639-1 code ("de") or an
+// English name ("German").
+func Lookup(s string) (Language, error) {
+	s = strings.TrimSpace(s)
+	if lang, ok := languages[strings.ToLower(s)]; ok {
+		return lang, nil
+	}
+	for _, lang := range languages {
+		if strings.EqualFold(lang.Name, s) {
+			return lang, nil
+		}
+	}
+	return Language{}, fmt.Errorf("unsupported language %q", s)
+}
@@ -0,0 +1,181 @@
+package pdf
+
+import (
+	"log"
+	"math"
+	"slices"
+)
+
+// gutter is an empty vertical strip between two columns of text.
+type gutter struct {
+	from, to float64
+}
+
+// readingOrder puts the line segments of a page in reading order. Where the
+// page is set in columns, each band of the page between lines spanning the
+// columns (titles, figures' captions) is read column by column; otherwise the
+// order in which the segments were drawn is kept. Segments on the same
+// baseline within a column are then merged into one line.
+func readingOrder(segments []line) []line {
+	gutters := findGutters(segments)
+	if len(gutters) == 0 {
+		return mergeSegments(segments)
+	}
+	log.Printf("Found %d columns", len(gutters)+1)
+
+	column := make([]int, len(segments))
+	for i, s := range segments {
+		column[i] = columnOf(s, gutters)
+	}
+	order := make([]int, len(segments))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return compareRows(segments[a], segments[b])
+	})
+
+	var ordered []line
+	var band []int
+	flush := func() {
+		slices.SortStableFunc(band, func(a, b int) int {
+			if column[a] != column[b] {
+				return column[a] - column[b]
+			}
+			return compareRows(segments[a], segments[b])
+		})
+		for _, i := range band {
+			s := segments[i]
+			s.column = column[i]
+			ordered = append(ordered, s)
+		}
+		band = band[:0]
+	}
+	for _, i := range order {
+		if column[i] < 0 {
+			flush()
+			s := segments[i]
+			s.column = -1
+			ordered = append(ordered, s)
+			continue
+		}
+		band = append(band, i)
+	}
+	flush()
+	return mergeSegments(ordered)
+}
+
+// compareRows orders segments top to bottom, and left to right on the same
+// baseline.
+func compareRows(a, b line) int {
+	if math.Abs(a.y-b.y) > math.Min(a.size, b.size)/2 {
+		if a.y > b.y {
+			return -1
+		}
+		return 1
+	}
+	switch {
+	case a.x < b.x:
+		return -1
+	case a.x > b.x:
+		return 1
+	}
+	return 0
+}
+
+// findGutters looks for vertical strips at least an em wide that almost no
+// segment crosses, with columns of prose on both sides: enough segments,
+// most of them wider than a few words, so that tables are not read column by
+// column.
+func findGutters(segments []line) []gutter {
+	if len(segments) < 6 {
+		return nil
+	}
+	left, right := math.Inf(1), math.Inf(-1)
+	var sizes []float64
+	for _, s := range segments {
+		left, right = math.Min(left, s.x), math.Max(right, s.end)
+		sizes = append(sizes, s.size)
+	}
+	em := median(sizes)
+	if right-left < em*10 {
+		return nil
+	}
+
+	// Count the segments covering each point across the page.
+	cover := make([]int, int(right-left)+1)
+	for _, s := range segments {
+		for x := int(s.x - left); x < int(s.end-left) && x < len(cover); x++ {
+			cover[x]++
+		}
+	}
+
+	var gutters []gutter
+	start := -1
+	for x := 0; x <= len(cover); x++ {
+		if x < len(cover) && cover[x]*5 <= len(segments) {
+			if start < 0 {
+				start = x
+			}
+			continue
+		}
+		if start > 0 && x < len(cover) && float64(x-start) >= em {
+			g := gutter{from: left + float64(start), to: left + float64(x)}
+			if prose(segments, g, em) {
+				gutters = append(gutters, g)
+			}
+		}
+		start = -1
+	}
+	return gutters
+}
+
+// prose reports whether both sides of a gutter hold a column of text.
+func prose(segments []line, g gutter, em float64) bool {
+	var leftWidths, rightWidths []float64
+	for _, s := range segments {
+		switch {
+		case s.end <= g.from:
+			leftWidths = append(leftWidths, s.end-s.x)
+		case s.x >= g.to:
+			rightWidths = append(rightWidths, s.end-s.x)
+		}
+	}
+	minLines := max(3, len(segments)*15/100)
+	return len(leftWidths) >= minLines && len(rightWidths) >= minLines &&
+		median(leftWidths) >= em*8 && median(rightWidths) >= em*8
+}
+
+// columnOf returns the column a segment lies in, counting from 0 at the
+// left, or -1 if it spans a gutter.
+func columnOf(s line, gutters []gutter) int {
+	column := 0
+	for _, g := range gutters {
+		switch {
+		case s.x >= g.to:
+			column++
+		case s.end > g.from:
+			return -1
+		}
+	}
+	return column
+}
+
+// mergeSegments joins consecutive segments on the same baseline and in the
+// same column into one line.
+func mergeSegments(segments []line) []line {
+	var lines []line
+	for _, s := range segments {
+		if n := len(lines); n > 0 && s.column == lines[n-1].column {
+			last := &lines[n-1]
+			if math.Abs(s.y-last.y) <= math.Max(last.size, s.size)/2 && s.x >= last.end {
+				last.text += " " + s.text
+				last.end = s.end
+				last.size = math.Max(last.size, s.size)
+				continue
+			}
+		}
+		lines = append(lines, s)
+	}
+	return lines
+}
@@ -0,0 +1,86 @@
+package pdf
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+// segmentsAt returns one segment per row from x to end, named after prefix,
+// with rows running down the page from y.
+func segmentsAt(prefix string, rows int, x, end, y float64) []line {
+	var segments []line
+	for i := range rows {
+		segments = append(segments, line{text: fmt.Sprintf("%s%d", prefix, i+1), x: x, y: y - float64(i)*12, end: end, size: 10})
+	}
+	return segments
+}
+
+// interleave returns the segments of both columns row by row, as a PDF
+// drawing its lines across the page would.
+func interleave(left, right []line) []line {
+	var segments []line
+	for i := range left {
+		segments = append(segments, left[i], right[i])
+	}
+	return segments
+}
+
+func TestFindGutters(t *testing.T) {
+	var table []line
+	for _, x := range []float64{72, 200, 330, 460} {
+		table = append(table, segmentsAt("cell", 10, x, x+40, 700)...)
+	}
+
+	tests := []struct {
+		name     string
+		segments []line
+		want     []gutter
+	}{
+		{"single column", segmentsAt("L", 10, 72, 528, 700), nil},
+		{"two columns", interleave(segmentsAt("L", 10, 72, 290, 700), segmentsAt("R", 10, 310, 528, 700)), []gutter{{from: 290, to: 310}}},
+		{"three columns", append(interleave(segmentsAt("L", 10, 72, 222, 700), segmentsAt("M", 10, 232, 382, 700)), segmentsAt("R", 10, 392, 542, 700)...), []gutter{{from: 222, to: 232}, {from: 382, to: 392}}},
+		{"table of short cells", table, nil},
+		{"too few segments", interleave(segmentsAt("L", 2, 72, 290, 700), segmentsAt("R", 2, 310, 528, 700)), nil},
+		{"narrow gap", interleave(segmentsAt("L", 10, 72, 296, 700), segmentsAt("R", 10, 300, 528, 700)), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := findGutters(tt.segments); !slices.Equal(got, tt.want) {
+				t.Errorf("findGutters() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadingOrder(t *testing.T) {
+	title := line{text: "Title", x: 72, y: 740, end: 528, size: 14}
+	segments := append([]line{title}, interleave(segmentsAt("L", 6, 72, 290, 700), segmentsAt("R", 6, 310, 528, 700))...)
+	footnote := line{text: "Footnote", x: 72, y: 600, end: 528, size: 8}
+	segments = append(segments, footnote)
+
+	var got []string
+	for _, l := range readingOrder(segments) {
+		got = append(got, l.text)
+	}
+	want := []string{"Title", "L1", "L2", "L3", "L4", "L5", "L6", "R1", "R2", "R3", "R4", "R5", "R6", "Footnote"}
+	if !slices.Equal(got, want) {
+		t.Errorf("readingOrder() = %q, want %q", got, want)
+	}
+
+	// Cells of a table stay in rows, with the cells of a row merged.
+	var table []line
+	for _, x := range []float64{72, 200, 330} {
+		table = append(table, segmentsAt(fmt.Sprintf("c%.0f-", x), 3, x, x+40, 700)...)
+	}
+	slices.SortStableFunc(table, compareRows)
+	got = got[:0]
+	for _, l := range readingOrder(table) {
+		got = append(got, l.text)
+	}
+	want = []string{"c72-1 c200-1 c330-1", "c72-2 c200-2 c330-2", "c72-3 c200-3 c330-3"}
+	if !slices.Equal(got, want) {
+		t.Errorf("readingOrder() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,48 @@
+package pdf
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// Errors returned by Extract for encrypted PDFs.
+var (
+	ErrPasswordRequired      = errors.New("PDF is encrypted and needs a password")
+	ErrWrongPassword         = errors.New("wrong PDF password")
+	ErrUnsupportedEncryption = errors.New("unsupported PDF encryption")
+)
+
+// openReader opens a PDF, decrypting it with password if it is encrypted.
+// PDFs that are only protected against editing open without one. The
+// library only decrypts RC4 and 128-bit AES; other schemes are reported as
+// ErrUnsupportedEncryption.
+func openReader(f *os.File, password string) (*pdf.Reader, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	tried := false
+	reader, err := pdf.NewReaderEncrypted(f, info.Size(), func() string {
+		if tried {
+			return ""
+		}
+		tried = true
+		return password
+	})
+	switch {
+	case err == nil:
+		return reader, nil
+	case errors.Is(err, pdf.ErrInvalidPassword) && password == "":
+		return nil, ErrPasswordRequired
+	case errors.Is(err, pdf.ErrInvalidPassword):
+		return nil, ErrWrongPassword
+	case strings.HasPrefix(err.Error(), "unsupported PDF: encryption"):
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedEncryption, err)
+	}
+	return nil, err
+}
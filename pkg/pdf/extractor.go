@@ -1,24 +1,65 @@
 package pdf
 
 import (
-	"bytes"
+	"fmt"
 	"io"
 	"log"
 	"os"
 	"strings"
 	"time"
-
-	"github.com/ledongthuc/pdf"
+	"unicode"
+	"unicode/utf8"
 )
 
+// Page locates a page in Document.Text. Start and End are character
+// offsets; Number counts from 1.
+type Page struct {
+	Number int
+	Start  int
+	End    int
+}
+
+// Document is the text of a PDF with a map of where each page starts.
+// Info and Outline hold the document's metadata and bookmarks; NumPages
+// counts all pages, including those that were not selected. Removed lists
+// the running headers, footers and page numbers left out of Text.
+type Document struct {
+	Text     string
+	Pages    []Page
+	Info     Info
+	Outline  []Section
+	NumPages int
+	Removed  []Furniture
+}
+
 func ExtractContent(r io.ReaderAt) (string, error) {
+	doc, err := Extract(r, nil, "")
+	if err != nil {
+		return "", err
+	}
+	return doc.Text, nil
+}
+
+// Extract reads the text of a PDF page by page, limited to the selected
+// pages if sel is not empty. An encrypted PDF is opened with password. Page
+// furniture is stripped and wrapped lines are re-flowed into paragraphs.
+// Pages are separated by a blank line unless a sentence runs on to the next
+// page. The PDF library panics on some malformed files; such a panic is
+// returned as an error.
+func Extract(r io.ReaderAt, sel *Selection, password string) (doc *Document, err error) {
 	startTime := time.Now()
 	log.Println("Starting PDF content extraction")
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Failed to read PDF: %v", r)
+			doc, err = nil, fmt.Errorf("malformed PDF: %v", r)
+		}
+	}()
 
 	tmpFile, err := os.CreateTemp("", "pdf-extract-*.pdf")
 	if err != nil {
 		log.Printf("Failed to create temporary file: %v", err)
-		return "", err
+		return nil, err
 	}
 	defer os.Remove(tmpFile.Name())
 	defer tmpFile.Close()
@@ -29,7 +70,7 @@ func ExtractContent(r io.ReaderAt) (string, error) {
 		bytesWritten, err := io.Copy(tmpFile, readSeeker)
 		if err != nil {
 			log.Printf("Failed to copy content to temporary file: %v", err)
-			return "", err
+			return nil, err
 		}
 		log.Printf("Copied %d bytes to temporary file", bytesWritten)
 	} else {
@@ -42,7 +83,7 @@ func ExtractContent(r io.ReaderAt) (string, error) {
 			if n > 0 {
 				if _, err := tmpFile.Write(data[:n]); err != nil {
 					log.Printf("Failed to write to temporary file: %v", err)
-					return "", err
+					return nil, err
 				}
 				totalBytes += int64(n)
 			}
@@ -51,7 +92,7 @@ func ExtractContent(r io.ReaderAt) (string, error) {
 			}
 			if err != nil {
 				log.Printf("Error reading from source: %v", err)
-				return "", err
+				return nil, err
 			}
 			offset += int64(n)
 		}
@@ -60,43 +101,106 @@ func ExtractContent(r io.ReaderAt) (string, error) {
 
 	if _, err := tmpFile.Seek(0, 0); err != nil {
 		log.Printf("Failed to rewind temporary file: %v", err)
-		return "", err
+		return nil, err
 	}
 	log.Println("Rewound temporary file to beginning")
 
 	log.Println("Opening PDF file with ledongthuc/pdf library")
-	f, reader, err := pdf.Open(tmpFile.Name())
+	reader, err := openReader(tmpFile, password)
 	if err != nil {
 		log.Printf("Failed to open PDF file: %v", err)
-		return "", err
+		return nil, err
 	}
-	defer f.Close()
 	log.Printf("PDF opened successfully, pages: %d", reader.NumPage())
 
-	log.Println("Extracting plain text from PDF")
-	var buf bytes.Buffer
-	b, err := reader.GetPlainText()
-	if err != nil {
-		log.Printf("Failed to extract plain text: %v", err)
-		return "", err
+	doc = &Document{NumPages: reader.NumPage(), Info: readInfo(reader), Outline: readOutline(reader)}
+	var selected map[int]bool
+	if !sel.empty() {
+		selected, err = sel.pages(doc.NumPages, doc.Outline)
+		if err != nil {
+			log.Printf("Invalid page selection: %v", err)
+			return nil, err
+		}
+		log.Printf("Extracting %d of %d pages", len(selected), doc.NumPages)
 	}
-	bytesRead, err := buf.ReadFrom(b)
-	if err != nil {
-		log.Printf("Failed to read plain text into buffer: %v", err)
-		return "", err
+
+	log.Println("Extracting text page by page")
+	var pages []pageLinesOf
+	for i := 1; i <= reader.NumPage(); i++ {
+		if selected != nil && !selected[i] {
+			continue
+		}
+		page := reader.Page(i)
+		if page.V.IsNull() {
+			log.Printf("Skipping page %d: no page object", i)
+			continue
+		}
+		lines, err := pageLines(page)
+		if err != nil {
+			log.Printf("Skipping page %d: failed to extract text: %v", i, err)
+			continue
+		}
+		pages = append(pages, pageLinesOf{number: i, lines: lines})
 	}
-	log.Printf("Read %d bytes of plain text from PDF", bytesRead)
+	doc.Removed = stripFurniture(pages)
 
-	result := normalizeText(buf.String())
-	wordCount := len(strings.Fields(result))
-	log.Printf("Text extraction completed in %v, extracted %d words", time.Since(startTime), wordCount)
-	return result, nil
+	reflow := newReflower(pages)
+	var rendered []pageLinesOf
+	var texts []string
+	for _, page := range pages {
+		pageText := normalizeText(renderLines(page.lines, reflow))
+		if pageText == "" {
+			log.Printf("Page %d has no text", page.number)
+			continue
+		}
+		rendered = append(rendered, page)
+		texts = append(texts, pageText)
+	}
+
+	var text strings.Builder
+	offset := 0
+	for i, pageText := range texts {
+		separator := ""
+		if i+1 < len(texts) {
+			var cut string
+			separator, cut = reflow.joinPages(pageText, texts[i+1])
+			pageText = strings.TrimSuffix(pageText, cut)
+		}
+		start := offset
+		text.WriteString(pageText)
+		offset += utf8.RuneCountInString(pageText)
+		doc.Pages = append(doc.Pages, Page{Number: rendered[i].number, Start: start, End: offset})
+		text.WriteString(separator)
+		offset += utf8.RuneCountInString(separator)
+	}
+	doc.Text = text.String()
+
+	wordCount := len(strings.Fields(doc.Text))
+	log.Printf("Text extraction completed in %v, extracted %d words from %d pages", time.Since(startTime), wordCount, len(doc.Pages))
+	return doc, nil
+}
+
+// runsOn reports whether text ends mid-sentence, so that the next line
+// continues its paragraph.
+func runsOn(text string) bool {
+	last, _ := utf8.DecodeLastRuneInString(strings.TrimRightFunc(text, unicode.IsSpace))
+	return last != utf8.RuneError && !strings.ContainsRune(".!?:;…。！？\"”’)", last)
+}
+
+// PageRange returns the first and last page numbers covering the character
+// range [start, end) of the document text.
+func (d *Document) PageRange(start, end int) (first, last int, ok bool) {
+	for _, p := range d.Pages {
+		if p.Start < max(end, start+1) && p.End > start {
+			if !ok {
+				first, ok = p.Number, true
+			}
+			last = p.Number
+		}
+	}
+	return first, last, ok
 }
 
 func normalizeText(s string) string {
-	log.Println("Normalizing extracted text")
-	normalized := strings.ReplaceAll(s, "\r\n", "\n")
-	wordCount := len(strings.Fields(normalized))
-	log.Printf("Text normalized, final length: %d words", wordCount)
-	return normalized
+	return strings.TrimSpace(strings.ReplaceAll(s, "\r\n", "\n"))
 }
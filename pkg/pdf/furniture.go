@@ -0,0 +1,288 @@
+package pdf
+
+import (
+	"log"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Kinds of page furniture.
+const (
+	FurnitureHeader     = "header"
+	FurnitureFooter     = "footer"
+	FurniturePageNumber = "page-number"
+)
+
+// Furniture describes lines removed from the pages: a running header or
+// footer, or page numbers. Text is the first removed line and Pages the
+// number of pages it was removed from.
+type Furniture struct {
+	Kind  string
+	Text  string
+	Pages int
+}
+
+// zoneLines is how many lines at the top and at the bottom of a page are
+// checked for furniture.
+const zoneLines = 2
+
+// minRepeats is how many pages a header or footer must appear on.
+const minRepeats = 3
+
+var (
+	digitsPattern     = regexp.MustCompile(`\d+`)
+	numberPattern     = regexp.MustCompile(`\d+|\b[ivxlcdm]+\b`)
+	barePagePattern   = regexp.MustCompile(`(?i)^[\s\-–—.]*(?:page\s+|p\.\s*)?(\d+|[ivxlcdm]+)(?:\s*(?:of|/)\s*\d+)?[\s\-–—.]*$`)
+	romanDigitsValues = map[rune]int{'i': 1, 'v': 5, 'x': 10, 'l': 50, 'c': 100, 'd': 500, 'm': 1000}
+)
+
+type pageLinesOf struct {
+	number int
+	lines  []line
+}
+
+// furnitureLine is a line in the top or bottom zone of a page.
+type furnitureLine struct {
+	page  int // index into the pages slice
+	index int // index into the page's lines
+	top   bool
+	text  string
+}
+
+// stripFurniture removes running headers, footers and page numbers from
+// the pages. A line at the top or bottom of a page is furniture if, with
+// its digits masked, it is found at the same end of at least minRepeats
+// pages and either repeats word for word or carries a number that keeps
+// step with the page number. This keeps chapter headings ("Chapter 3"),
+// which change from page to page without following the page numbers. A
+// bare number that equals its page number is removed on its own, as is a
+// line ending in a number at the offset the other page numbers keep.
+func stripFurniture(pages []pageLinesOf) []Furniture {
+	groups := make(map[string][]furnitureLine)
+	var keys []string
+	for p, page := range pages {
+		for _, fl := range zones(p, page.lines) {
+			key := furnitureKey(fl)
+			if _, ok := groups[key]; !ok {
+				keys = append(keys, key)
+			}
+			groups[key] = append(groups[key], fl)
+		}
+	}
+
+	remove := make(map[[2]int]bool)
+	var removed []Furniture
+	offsets := make(map[int]int)
+	matchedKeys := make(map[string]bool)
+	report := func(key string, matched []furnitureLine) {
+		kind := FurnitureFooter
+		switch {
+		case barePagePattern.MatchString(matched[0].text):
+			kind = FurniturePageNumber
+		case matched[0].top:
+			kind = FurnitureHeader
+		}
+		for _, fl := range matched {
+			remove[[2]int{fl.page, fl.index}] = true
+		}
+		matchedKeys[key] = true
+		removed = append(removed, Furniture{Kind: kind, Text: matched[0].text, Pages: len(matched)})
+		log.Printf("Removing %s %q from %d pages", kind, matched[0].text, len(matched))
+	}
+
+	for _, key := range keys {
+		group := groups[key]
+		bare := barePagePattern.MatchString(group[0].text)
+
+		// Lines with numbers are only removed if their number keeps the
+		// same offset from the page number as most of the group.
+		offset, numbered := pageOffset(pages, group)
+		if !numbered && bare {
+			offset = 0
+		}
+		var matched []furnitureLine
+		for _, fl := range group {
+			n, ok := lineNumber(fl.text)
+			switch {
+			case numbered || bare:
+				if ok && n-pages[fl.page].number == offset {
+					matched = append(matched, fl)
+				}
+			case len(group) >= minRepeats && repeatsVerbatim(group):
+				matched = append(matched, fl)
+			}
+		}
+		if len(matched) > 0 {
+			if numbered {
+				offsets[offset] += len(matched)
+			}
+			report(key, matched)
+		}
+	}
+
+	// Headers that change with each chapter can be too short-lived to
+	// repeat; they are recognised by ending in the page number at the
+	// offset the other furniture has shown. Headings that start with a
+	// chapter number are left alone.
+	if offset, ok := modalOffset(offsets); ok {
+		for _, key := range keys {
+			if matchedKeys[key] {
+				continue
+			}
+			var matched []furnitureLine
+			for _, fl := range groups[key] {
+				n, found := trailingNumber(fl.text)
+				if found && n-pages[fl.page].number == offset && len(strings.Fields(fl.text)) <= 12 {
+					matched = append(matched, fl)
+				}
+			}
+			if len(matched) > 0 {
+				report(key, matched)
+			}
+		}
+	}
+
+	for p, page := range pages {
+		kept := page.lines[:0]
+		for i, l := range page.lines {
+			if !remove[[2]int{p, i}] {
+				kept = append(kept, l)
+			}
+		}
+		pages[p].lines = kept
+	}
+	return removed
+}
+
+// zones returns the top and bottom lines of a page by position. A line is
+// only counted once if the page is short.
+func zones(p int, lines []line) []furnitureLine {
+	order := make([]int, len(lines))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		switch {
+		case lines[a].y > lines[b].y:
+			return -1
+		case lines[a].y < lines[b].y:
+			return 1
+		}
+		return 0
+	})
+
+	var zone []furnitureLine
+	seen := make(map[int]bool)
+	for k, i := range order {
+		top := k < zoneLines
+		if (top || k >= len(order)-zoneLines) && !seen[i] {
+			seen[i] = true
+			zone = append(zone, furnitureLine{page: p, index: i, top: top, text: lines[i].text})
+		}
+	}
+	return zone
+}
+
+// furnitureKey groups lines that differ only in their numbers, at the same
+// end of the page.
+func furnitureKey(fl furnitureLine) string {
+	text := strings.ToLower(strings.Join(strings.Fields(fl.text), " "))
+	if barePagePattern.MatchString(text) {
+		text = "#"
+	} else {
+		text = digitsPattern.ReplaceAllString(text, "#")
+	}
+	if fl.top {
+		return "top:" + text
+	}
+	return "bottom:" + text
+}
+
+// modalOffset returns the page number offset most furniture lines share.
+func modalOffset(offsets map[int]int) (int, bool) {
+	best, count := 0, 0
+	for offset, n := range offsets {
+		if n > count || (n == count && offset < best) {
+			best, count = offset, n
+		}
+	}
+	return best, count >= minRepeats
+}
+
+// repeatsVerbatim reports whether most lines of a group have the same text.
+func repeatsVerbatim(group []furnitureLine) bool {
+	counts := make(map[string]int)
+	most := 0
+	for _, fl := range group {
+		counts[fl.text]++
+		most = max(most, counts[fl.text])
+	}
+	return most >= minRepeats && most*2 >= len(group)
+}
+
+// pageOffset returns the offset from the page number that the numbers in
+// most of a group of lines keep, as printed page numbers do, and whether
+// there is one.
+func pageOffset(pages []pageLinesOf, group []furnitureLine) (offset int, ok bool) {
+	offsets := make(map[int]int)
+	most := 0
+	for _, fl := range group {
+		n, found := lineNumber(fl.text)
+		if !found {
+			continue
+		}
+		o := n - pages[fl.page].number
+		offsets[o]++
+		if offsets[o] > most {
+			offset, most = o, offsets[o]
+		}
+	}
+	return offset, most >= minRepeats && most*5 >= len(group)*4
+}
+
+// lineNumber returns the number a header or footer is likely to print the
+// page number as: the number at the end of the line ("Chapter 2: Methods
+// 17") or else the first one ("17 Methods"). Roman numerals are read when
+// the line is a bare page number.
+func lineNumber(text string) (int, bool) {
+	text = strings.ToLower(text)
+	tokens := numberPattern.FindAllStringIndex(text, -1)
+	if len(tokens) > 1 && tokens[len(tokens)-1][1] == len(strings.TrimRight(text, " .")) {
+		tokens = tokens[len(tokens)-1:]
+	}
+	for _, t := range tokens {
+		token := text[t[0]:t[1]]
+		if n, err := strconv.Atoi(token); err == nil {
+			return n, true
+		}
+		if barePagePattern.MatchString(text) {
+			return romanValue(token), true
+		}
+	}
+	return 0, false
+}
+
+// trailingNumber returns the number a line ends with.
+func trailingNumber(text string) (int, bool) {
+	fields := strings.Fields(strings.TrimRight(text, " ."))
+	if len(fields) == 0 {
+		return 0, false
+	}
+	n, err := strconv.Atoi(fields[len(fields)-1])
+	return n, err == nil
+}
+
+func romanValue(s string) int {
+	total := 0
+	for i, r := range s {
+		v := romanDigitsValues[r]
+		if i+1 < len(s) && romanDigitsValues[rune(s[i+1])] > v {
+			total -= v
+		} else {
+			total += v
+		}
+	}
+	return total
+}
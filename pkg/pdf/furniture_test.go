@@ -0,0 +1,172 @@
+package pdf
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// bodyLines is the number of body lines withLines puts on each test page.
+const bodyLines = 3
+
+// testPage builds a page whose lines are stacked from the top down.
+func testPage(number int, texts ...string) pageLinesOf {
+	page := pageLinesOf{number: number}
+	for i, text := range texts {
+		page.lines = append(page.lines, line{text: text, x: 72, y: 720 - float64(i)*14, end: 300, size: 10})
+	}
+	return page
+}
+
+func TestStripFurniture(t *testing.T) {
+	// Body lines differ from page to page, as they do in a real document.
+	words := strings.Fields("alpha bravo charlie delta echo foxtrot golf hotel india juliet")
+	page := 0
+	withLines := func(top, bottom string) []string {
+		var lines []string
+		if top != "" {
+			lines = append(lines, top)
+		}
+		for i := range bodyLines {
+			lines = append(lines, fmt.Sprintf("Body text %s %s %s.", words[page/len(words)], words[page%len(words)], words[i]))
+		}
+		page++
+		if bottom != "" {
+			lines = append(lines, bottom)
+		}
+		return lines
+	}
+
+	tests := []struct {
+		name    string
+		pages   []pageLinesOf
+		removed []Furniture
+		kept    []string // lines kept outside the body, page by page
+	}{
+		{
+			name: "header with page numbers",
+			pages: []pageLinesOf{
+				testPage(1, withLines("Annual Report 2023 11", "")...),
+				testPage(2, withLines("Annual Report 2023 12", "")...),
+				testPage(3, withLines("Annual Report 2023 13", "")...),
+				testPage(4, withLines("Annual Report 2023 14", "")...),
+			},
+			removed: []Furniture{{Kind: FurnitureHeader, Text: "Annual Report 2023 11", Pages: 4}},
+		},
+		{
+			name: "alternating headers with page numbers",
+			pages: []pageLinesOf{
+				testPage(1, withLines("12 A Short History", "")...),
+				testPage(2, withLines("Early Years 13", "")...),
+				testPage(3, withLines("14 A Short History", "")...),
+				testPage(4, withLines("Early Years 15", "")...),
+				testPage(5, withLines("16 A Short History", "")...),
+				testPage(6, withLines("Early Years 17", "")...),
+			},
+			removed: []Furniture{
+				{Kind: FurnitureHeader, Text: "12 A Short History", Pages: 3},
+				{Kind: FurnitureHeader, Text: "Early Years 13", Pages: 3},
+			},
+		},
+		{
+			name: "header and footer without page numbers",
+			pages: []pageLinesOf{
+				testPage(1, withLines("A Short History", "Confidential")...),
+				testPage(2, withLines("A Short History", "Confidential")...),
+				testPage(3, withLines("A Short History", "Confidential")...),
+			},
+			removed: []Furniture{
+				{Kind: FurnitureHeader, Text: "A Short History", Pages: 3},
+				{Kind: FurnitureFooter, Text: "Confidential", Pages: 3},
+			},
+		},
+		{
+			name: "header on too few pages",
+			pages: []pageLinesOf{
+				testPage(1, withLines("A Short History", "")...),
+				testPage(2, withLines("A Short History", "")...),
+			},
+			kept: []string{"A Short History", "A Short History"},
+		},
+		{
+			name: "page numbers",
+			pages: []pageLinesOf{
+				testPage(1, withLines("", "- 1 -")...),
+				testPage(2, withLines("", "- 2 -")...),
+				testPage(3, withLines("", "- 3 -")...),
+			},
+			removed: []Furniture{{Kind: FurniturePageNumber, Text: "- 1 -", Pages: 3}},
+		},
+		{
+			name: "roman numeral front matter",
+			pages: []pageLinesOf{
+				testPage(1, withLines("", "i")...),
+				testPage(2, withLines("", "ii")...),
+				testPage(3, withLines("", "iii")...),
+				testPage(4, withLines("", "iv")...),
+				testPage(5, withLines("", "1")...),
+				testPage(6, withLines("", "2")...),
+				testPage(7, withLines("", "3")...),
+			},
+			removed: []Furniture{{Kind: FurniturePageNumber, Text: "i", Pages: 4}},
+			kept:    []string{"1", "2", "3"},
+		},
+		{
+			name: "chapter headings kept",
+			pages: []pageLinesOf{
+				testPage(1, withLines("", "1")...),
+				testPage(2, withLines("Chapter 1", "2")...),
+				testPage(3, withLines("", "3")...),
+				testPage(4, withLines("", "4")...),
+				testPage(5, withLines("Chapter 2", "5")...),
+				testPage(6, withLines("", "6")...),
+				testPage(7, withLines("", "7")...),
+				testPage(8, withLines("Chapter 3", "8")...),
+			},
+			removed: []Furniture{{Kind: FurniturePageNumber, Text: "1", Pages: 8}},
+			kept:    []string{"Chapter 1", "Chapter 2", "Chapter 3"},
+		},
+		{
+			name: "short-lived chapter header",
+			pages: []pageLinesOf{
+				testPage(1, withLines("", "1")...),
+				testPage(2, withLines("", "2")...),
+				testPage(3, withLines("", "3")...),
+				testPage(4, withLines("Methods 4", "")...),
+				testPage(5, withLines("Methods 5", "")...),
+			},
+			removed: []Furniture{
+				{Kind: FurniturePageNumber, Text: "1", Pages: 3},
+				{Kind: FurnitureHeader, Text: "Methods 4", Pages: 2},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			removed := stripFurniture(tt.pages)
+			if !slices.Equal(removed, tt.removed) {
+				t.Errorf("removed %+v, want %+v", removed, tt.removed)
+			}
+
+			var kept []string
+			for _, page := range tt.pages {
+				n := 0
+				for _, l := range page.lines {
+					if strings.HasPrefix(l.text, "Body text ") {
+						n++
+					} else {
+						kept = append(kept, l.text)
+					}
+				}
+				if n != bodyLines {
+					t.Errorf("page %d kept %d of %d body lines", page.number, n, bodyLines)
+				}
+			}
+			if !slices.Equal(kept, tt.kept) {
+				t.Errorf("kept %q, want %q", kept, tt.kept)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package pdf
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// glyph is a character drawn on a page: its text, the position of its
+// baseline origin and its advance width, in points.
+type glyph struct {
+	s    string
+	x, y float64
+	w    float64
+	size float64
+}
+
+// matrix is an affine transformation [a b c d e f], as in PDF.
+type matrix [6]float64
+
+var identity = matrix{1, 0, 0, 1, 0, 0}
+
+// mul returns m × n: m applied first, then n.
+func (m matrix) mul(n matrix) matrix {
+	return matrix{
+		m[0]*n[0] + m[1]*n[2],
+		m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2],
+		m[2]*n[1] + m[3]*n[3],
+		m[4]*n[0] + m[5]*n[2] + n[4],
+		m[4]*n[1] + m[5]*n[3] + n[5],
+	}
+}
+
+func translate(x, y float64) matrix {
+	return matrix{1, 0, 0, 1, x, y}
+}
+
+// font is what the glyph walker needs from a font, read once per page.
+// Page.Content reads the encoding and widths again for every glyph, which
+// is too slow for books.
+type font struct {
+	enc    pdf.TextEncoding
+	first  int
+	widths []float64
+}
+
+func loadFont(f pdf.Font) *font {
+	return &font{enc: f.Encoder(), first: f.FirstChar(), widths: f.Widths()}
+}
+
+// width returns the advance of a character code in text space units per
+// point of font size, or 0 if the font does not say.
+func (f *font) width(code int) float64 {
+	if i := code - f.first; i >= 0 && i < len(f.widths) {
+		return f.widths[i] / 1000
+	}
+	return 0
+}
+
+type textState struct {
+	ctm     matrix
+	tm, tlm matrix
+	font    *font
+	size    float64
+	tc, tw  float64
+	th      float64
+	tl      float64
+	rise    float64
+}
+
+// pageGlyphs returns the glyphs of a page in the order they are drawn. Where
+// a font gives no widths, as for the standard fonts and most CID fonts,
+// glyphs are assumed to be half an em wide.
+func pageGlyphs(p pdf.Page) []glyph {
+	fonts := make(map[string]*font)
+	fontFor := func(name string) *font {
+		if f, ok := fonts[name]; ok {
+			return f
+		}
+		f := loadFont(p.Font(name))
+		fonts[name] = f
+		return f
+	}
+
+	var glyphs []glyph
+	g := textState{ctm: identity, tm: identity, tlm: identity, th: 1}
+	var stack []textState
+
+	show := func(raw string) {
+		if g.font == nil {
+			return
+		}
+		decoded := g.font.enc.Decode(raw)
+		// Simple fonts have one byte per character; widths can only be
+		// looked up when the decoded text lines up with the codes.
+		perByte := utf8.RuneCountInString(decoded) == len(raw)
+		for i, r := range []rune(decoded) {
+			w0 := 0.5
+			if perByte {
+				if w := g.font.width(int(raw[i])); w > 0 {
+					w0 = w
+				}
+			}
+			trm := matrix{g.size * g.th, 0, 0, g.size, 0, g.rise}.mul(g.tm).mul(g.ctm)
+			glyphs = append(glyphs, glyph{s: string(r), x: trm[4], y: trm[5], w: w0 * trm[0], size: trm[3]})
+
+			tx := w0*g.size + g.tc
+			if r == ' ' {
+				tx += g.tw
+			}
+			g.tm = translate(tx*g.th, 0).mul(g.tm)
+		}
+	}
+
+	interpret := func(stk *pdf.Stack, op string) {
+		n := stk.Len()
+		args := make([]pdf.Value, n)
+		for i := n - 1; i >= 0; i-- {
+			args[i] = stk.Pop()
+		}
+		number := func(i int) float64 {
+			if i < len(args) {
+				return args[i].Float64()
+			}
+			return 0
+		}
+		nextLine := func() {
+			g.tlm = translate(0, -g.tl).mul(g.tlm)
+			g.tm = g.tlm
+		}
+
+		switch op {
+		case "q":
+			stack = append(stack, g)
+		case "Q":
+			if len(stack) > 0 {
+				g = stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+			}
+		case "cm":
+			g.ctm = matrix{number(0), number(1), number(2), number(3), number(4), number(5)}.mul(g.ctm)
+		case "BT":
+			g.tm, g.tlm = identity, identity
+		case "Tm":
+			g.tm = matrix{number(0), number(1), number(2), number(3), number(4), number(5)}
+			g.tlm = g.tm
+		case "TD":
+			g.tl = -number(1)
+			fallthrough
+		case "Td":
+			g.tlm = translate(number(0), number(1)).mul(g.tlm)
+			g.tm = g.tlm
+		case "T*":
+			nextLine()
+		case "TL":
+			g.tl = number(0)
+		case "Tc":
+			g.tc = number(0)
+		case "Tw":
+			g.tw = number(0)
+		case "Tz":
+			g.th = number(0) / 100
+		case "Ts":
+			g.rise = number(0)
+		case "Tf":
+			if len(args) == 2 {
+				g.font = fontFor(args[0].Name())
+				g.size = args[1].Float64()
+			}
+		case "Tj":
+			if len(args) == 1 {
+				show(args[0].RawString())
+			}
+		case "'":
+			nextLine()
+			if len(args) == 1 {
+				show(args[0].RawString())
+			}
+		case "\"":
+			if len(args) == 3 {
+				g.tw, g.tc = number(0), number(1)
+				nextLine()
+				show(args[2].RawString())
+			}
+		case "TJ":
+			if len(args) != 1 {
+				return
+			}
+			for i := 0; i < args[0].Len(); i++ {
+				x := args[0].Index(i)
+				if x.Kind() == pdf.String {
+					show(x.RawString())
+				} else {
+					g.tm = translate(-x.Float64()/1000*g.size*g.th, 0).mul(g.tm)
+				}
+			}
+		}
+	}
+
+	contents := p.V.Key("Contents")
+	if contents.Kind() == pdf.Array {
+		for i := 0; i < contents.Len(); i++ {
+			pdf.Interpret(contents.Index(i), interpret)
+		}
+	} else {
+		pdf.Interpret(contents, interpret)
+	}
+	return glyphs
+}
+
+// isBlank reports whether a glyph draws no visible text.
+func (g glyph) isBlank() bool {
+	return strings.TrimSpace(g.s) == ""
+}
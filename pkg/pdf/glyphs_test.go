@@ -0,0 +1,140 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// testContentPage builds a one-page PDF drawing content and returns the
+// page. F1 is Helvetica without widths; F2 is Courier with its widths of 600
+// units for every character.
+func testContentPage(t *testing.T, content string) pdf.Page {
+	t.Helper()
+	widths := strings.TrimSpace(strings.Repeat("600 ", 95))
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Resources << /Font << /F1 4 0 R /F2 5 0 R >> >> /Contents 6 0 R >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier /FirstChar 32 /LastChar 126 /Widths [" + widths + "] >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content)+1, content),
+	}
+
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	reader, err := pdf.NewReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reader.Page(1)
+}
+
+func TestPageGlyphs(t *testing.T) {
+	type drawn struct {
+		s    string
+		x, y float64
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		want    []drawn
+	}{
+		{
+			name:    "text matrix and widths",
+			content: "BT /F2 10 Tf 1 0 0 1 100 700 Tm (ab) Tj ET",
+			want:    []drawn{{"a", 100, 700}, {"b", 106, 700}},
+		},
+		{
+			name:    "scaled text matrix",
+			content: "BT /F2 1 Tf 10 0 0 10 100 700 Tm (ab) Tj ET",
+			want:    []drawn{{"a", 100, 700}, {"b", 106, 700}},
+		},
+		{
+			name:    "line moves and leading",
+			content: "BT /F2 10 Tf 100 700 Td (a) Tj 12 TL T* (b) Tj 20 0 Td (c) Tj ET",
+			want:    []drawn{{"a", 100, 700}, {"b", 100, 688}, {"c", 120, 688}},
+		},
+		{
+			name:    "TD sets the leading",
+			content: "BT /F2 10 Tf 100 700 Td (a) Tj 0 -14 TD (b) Tj T* (c) Tj ET",
+			want:    []drawn{{"a", 100, 700}, {"b", 100, 686}, {"c", 100, 672}},
+		},
+		{
+			name:    "next line operators",
+			content: "BT /F2 10 Tf 12 TL 100 700 Td (a) Tj (b) ' 1 2 (c) \" ET",
+			want:    []drawn{{"a", 100, 700}, {"b", 100, 688}, {"c", 100, 676}},
+		},
+		{
+			name:    "TJ spacing",
+			content: "BT /F2 10 Tf 100 700 Td [(a) -1000 (b) 500 (c)] TJ ET",
+			want:    []drawn{{"a", 100, 700}, {"b", 116, 700}, {"c", 117, 700}},
+		},
+		{
+			name:    "character and word spacing",
+			content: "BT /F2 10 Tf 2 Tc 5 Tw 100 700 Td (a b) Tj ET",
+			want:    []drawn{{"a", 100, 700}, {" ", 108, 700}, {"b", 121, 700}},
+		},
+		{
+			name:    "horizontal scaling",
+			content: "BT /F2 10 Tf 50 Tz 100 700 Td (ab) Tj ET",
+			want:    []drawn{{"a", 100, 700}, {"b", 103, 700}},
+		},
+		{
+			name:    "missing widths",
+			content: "BT /F1 10 Tf 100 700 Td (ab) Tj ET",
+			want:    []drawn{{"a", 100, 700}, {"b", 105, 700}},
+		},
+		{
+			name:    "graphics state",
+			content: "q 1 0 0 1 50 0 cm BT /F2 10 Tf 100 700 Td (a) Tj ET Q BT /F2 10 Tf 100 700 Td (b) Tj ET",
+			want:    []drawn{{"a", 150, 700}, {"b", 100, 700}},
+		},
+		{
+			name:    "no font",
+			content: "BT 100 700 Td (a) Tj ET",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			glyphs := pageGlyphs(testContentPage(t, tt.content))
+			if len(glyphs) != len(tt.want) {
+				t.Fatalf("pageGlyphs() returned %d glyphs %+v, want %d", len(glyphs), glyphs, len(tt.want))
+			}
+			for i, g := range glyphs {
+				w := tt.want[i]
+				if g.s != w.s || math.Abs(g.x-w.x) > 1e-6 || math.Abs(g.y-w.y) > 1e-6 {
+					t.Errorf("glyph %d = %q at (%g, %g), want %q at (%g, %g)", i, g.s, g.x, g.y, w.s, w.x, w.y)
+				}
+			}
+		})
+	}
+}
+
+func TestPageGlyphsSize(t *testing.T) {
+	glyphs := pageGlyphs(testContentPage(t, "BT /F2 1 Tf 12 0 0 12 100 700 Tm (a) Tj ET"))
+	if len(glyphs) != 1 {
+		t.Fatalf("pageGlyphs() returned %d glyphs, want 1", len(glyphs))
+	}
+	if g := glyphs[0]; g.size != 12 || math.Abs(g.w-7.2) > 1e-6 {
+		t.Errorf("glyph size %g, width %g, want 12, 7.2", g.size, g.w)
+	}
+}
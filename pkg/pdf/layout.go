@@ -0,0 +1,157 @@
+package pdf
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// ligatures spells out typographic ligatures, which would otherwise split
+// words for search and de-hyphenation.
+var ligatures = strings.NewReplacer("ﬀ", "ff", "ﬁ", "fi", "ﬂ", "fl", "ﬃ", "ffi", "ﬄ", "ffl", "ﬅ", "st", "ﬆ", "st")
+
+// line is a line of text on a page, with the position of its first glyph,
+// where its last glyph ends and its font size, in points. Column counts the
+// page's columns from 0 at the left, or is -1 for a line spanning them.
+type line struct {
+	text   string
+	x, y   float64
+	end    float64
+	size   float64
+	column int
+}
+
+// pageLines reads the glyphs of a page, groups them into lines and puts the
+// lines in reading order. A glyph starts a new line segment when its
+// baseline moves by more than half the font size, when it jumps back to the
+// left or when it is more than one and a half ems past the previous one, as
+// across the gap between two columns. A space is put between glyphs more
+// than 0.15 em apart, a little under a word space.
+func pageLines(p pdf.Page) (lines []line, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			lines, err = nil, errors.New(fmt.Sprint(r))
+		}
+	}()
+
+	var current *line
+	var builder strings.Builder
+	var lastEnd float64
+	flush := func() {
+		if current != nil {
+			if current.text = strings.TrimSpace(builder.String()); current.text != "" {
+				current.end = lastEnd
+				lines = append(lines, *current)
+			}
+		}
+		current = nil
+		builder.Reset()
+	}
+
+	for _, g := range pageGlyphs(p) {
+		size := math.Max(g.size, 1)
+		if current != nil && (math.Abs(g.y-current.y) > size/2 || g.x < lastEnd-size || g.x > lastEnd+size*1.5) {
+			flush()
+		}
+		if g.isBlank() {
+			if current != nil && !strings.HasSuffix(builder.String(), " ") {
+				builder.WriteByte(' ')
+				lastEnd = g.x + g.w
+			}
+			continue
+		}
+		if current == nil {
+			current = &line{x: g.x, y: g.y, size: size}
+		} else if g.x-lastEnd > size*0.15 && !strings.HasSuffix(builder.String(), " ") {
+			builder.WriteByte(' ')
+		}
+		builder.WriteString(ligatures.Replace(g.s))
+		current.size = math.Max(current.size, size)
+		lastEnd = g.x + g.w
+	}
+	flush()
+	return readingOrder(lines), nil
+}
+
+// renderLines re-flows the lines of a page into paragraphs separated by
+// blank lines.
+func renderLines(lines []line, r *reflower) string {
+	var text strings.Builder
+	for i, paragraph := range paragraphs(lines) {
+		if i > 0 {
+			text.WriteString("\n\n")
+		}
+		joined := ""
+		for _, l := range paragraph {
+			joined = r.join(joined, l.text)
+		}
+		text.WriteString(joined)
+	}
+	return text.String()
+}
+
+// paragraphs groups the lines of a page into paragraphs. A paragraph ends
+// where the gap to the next line is clearly wider than the usual line
+// spacing, where the text moves up the page to a new column or text box
+// without a sentence running on,
+// where the font size changes, as after a heading, and where a sentence
+// ends well short of its column's right margin or is followed by an
+// indented line.
+func paragraphs(lines []line) [][]line {
+	if len(lines) == 0 {
+		return nil
+	}
+
+	var gaps []float64
+	lefts := make(map[int][]float64)
+	ends := make(map[int][]float64)
+	for i, l := range lines {
+		if i > 0 {
+			if gap := lines[i-1].y - l.y; gap > 0 {
+				gaps = append(gaps, gap)
+			}
+		}
+		lefts[l.column] = append(lefts[l.column], l.x)
+		ends[l.column] = append(ends[l.column], l.end)
+	}
+	spacing := median(gaps)
+	left := make(map[int]float64)
+	right := make(map[int]float64)
+	for column := range lefts {
+		slices.Sort(lefts[column])
+		slices.Sort(ends[column])
+		left[column] = lefts[column][len(lefts[column])/10]
+		right[column] = ends[column][len(ends[column])*9/10]
+	}
+
+	var result [][]line
+	start := 0
+	for i := 1; i < len(lines); i++ {
+		prev, l := lines[i-1], lines[i]
+		gap := prev.y - l.y
+		size := math.Max(prev.size, l.size)
+		newParagraph := (gap <= 0 && !continues(prev.text)) ||
+			(spacing > 0 && gap > spacing*1.5) ||
+			size/math.Min(prev.size, l.size) > 1.15 ||
+			(!runsOn(prev.text) && prev.end < right[prev.column]-size*3) ||
+			(!runsOn(prev.text) && l.column == prev.column && l.x > left[l.column]+size*0.8 && prev.x < left[l.column]+size*0.4)
+		if newParagraph {
+			result = append(result, lines[start:i])
+			start = i
+		}
+	}
+	return append(result, lines[start:])
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	return sorted[len(sorted)/2]
+}
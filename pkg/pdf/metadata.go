@@ -0,0 +1,68 @@
+package pdf
+
+import (
+	"log"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// Info is the document information dictionary of a PDF. Fields the file
+// does not set are empty.
+type Info struct {
+	Title   string
+	Author  string
+	Subject string
+}
+
+var (
+	// Word processors and printer drivers put the application and file
+	// name where the title belongs ("Microsoft Word - report.docx").
+	producerPrefixPattern = regexp.MustCompile(`(?i)^(?:microsoft\s+\w+|powerpoint|word)\s+-\s+`)
+	placeholderTitles     = map[string]bool{"untitled": true, "title": true, "document": true, "none": true}
+)
+
+func readInfo(reader *pdf.Reader) Info {
+	dict := reader.Trailer().Key("Info")
+	info := Info{
+		Title:   cleanTitle(dict.Key("Title").Text()),
+		Author:  strings.TrimSpace(dict.Key("Author").Text()),
+		Subject: strings.TrimSpace(dict.Key("Subject").Text()),
+	}
+	log.Printf("Document info: title %q, author %q, subject %q", info.Title, info.Author, info.Subject)
+	return info
+}
+
+// cleanTitle drops titles that only name the file the PDF was made from.
+func cleanTitle(title string) string {
+	title = strings.Join(strings.Fields(title), " ")
+	title = producerPrefixPattern.ReplaceAllString(title, "")
+	switch strings.ToLower(path.Ext(title)) {
+	case ".doc", ".docx", ".odt", ".rtf", ".txt", ".tex", ".dvi", ".pdf", ".ps", ".indd", ".pages", ".ppt", ".pptx", ".html", ".htm":
+		return ""
+	}
+	if placeholderTitles[strings.ToLower(title)] {
+		return ""
+	}
+	return title
+}
+
+// ChapterTitles returns the titles of the outline entries most likely to be
+// chapters: the top level, or the level below when the top level holds a
+// single entry such as the book's own title.
+func (d *Document) ChapterTitles() []string {
+	for level := 1; level <= 2; level++ {
+		var titles []string
+		for _, s := range d.Outline {
+			if s.Level == level {
+				titles = append(titles, s.Title)
+			}
+		}
+		if len(titles) >= 2 {
+			return titles
+		}
+	}
+	return nil
+}
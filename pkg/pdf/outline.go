@@ -0,0 +1,97 @@
+package pdf
+
+import (
+	"log"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// Section is an entry of the document outline (bookmarks). Level is 1 for
+// top-level entries; Page is 0 if the entry's destination is unknown.
+type Section struct {
+	Title string
+	Level int
+	Page  int
+}
+
+// readOutline returns the outline entries depth-first. The library's
+// Outline drops destinations, so the outline tree is walked here.
+func readOutline(reader *pdf.Reader) []Section {
+	root := reader.Trailer().Key("Root")
+
+	// Pages are matched by their printed dictionary, which holds the
+	// references to their contents and so tells pages apart.
+	pageNumbers := make(map[string]int)
+	for i := 1; i <= reader.NumPage(); i++ {
+		key := reader.Page(i).V.String()
+		if _, ok := pageNumbers[key]; !ok {
+			pageNumbers[key] = i
+		}
+	}
+
+	var sections []Section
+	var walk func(entry pdf.Value, level int)
+	walk = func(entry pdf.Value, level int) {
+		// A malformed outline can loop; no real one is this long.
+		for item := entry.Key("First"); item.Kind() == pdf.Dict && len(sections) < 10000; item = item.Key("Next") {
+			dest := item.Key("Dest")
+			if dest.IsNull() {
+				dest = item.Key("A").Key("D")
+			}
+			sections = append(sections, Section{
+				Title: item.Key("Title").Text(),
+				Level: level,
+				Page:  pageNumbers[destPage(root, dest).String()],
+			})
+			walk(item, level+1)
+		}
+	}
+	walk(root.Key("Outlines"), 1)
+
+	log.Printf("Read %d outline entries", len(sections))
+	return sections
+}
+
+// destPage returns the page dictionary a destination points to. Named
+// destinations are looked up in the catalog's Dests dictionary or Names
+// tree.
+func destPage(root, dest pdf.Value) pdf.Value {
+	switch dest.Kind() {
+	case pdf.Name:
+		dest = root.Key("Dests").Key(dest.Name())
+	case pdf.String:
+		dest = lookupName(root.Key("Names").Key("Dests"), dest.RawString(), 0)
+	}
+	if dest.Kind() == pdf.Dict {
+		dest = dest.Key("D")
+	}
+	if dest.Kind() != pdf.Array || dest.Len() == 0 {
+		return pdf.Value{}
+	}
+	return dest.Index(0)
+}
+
+// lookupName finds a key in a name tree.
+func lookupName(node pdf.Value, key string, depth int) pdf.Value {
+	if depth > 32 {
+		return pdf.Value{}
+	}
+	names := node.Key("Names")
+	for i := 0; i+1 < names.Len(); i += 2 {
+		if names.Index(i).RawString() == key {
+			return names.Index(i + 1)
+		}
+	}
+	kids := node.Key("Kids")
+	for i := 0; i < kids.Len(); i++ {
+		kid := kids.Index(i)
+		if limits := kid.Key("Limits"); limits.Len() == 2 &&
+			(key < limits.Index(0).RawString() || key > limits.Index(1).RawString()) {
+			continue
+		}
+		if v := lookupName(kid, key, depth+1); !v.IsNull() {
+			return v
+		}
+	}
+	return pdf.Value{}
+}
@@ -0,0 +1,154 @@
+package pdf
+
+import (
+	"bufio"
+	_ "embed"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+//go:embed compounds.txt
+var builtinCompounds string
+
+// compounds is the word list of hyphenated words, split by kind of entry.
+type compounds struct {
+	words    map[string]bool
+	prefixes map[string]bool
+	suffixes map[string]bool
+}
+
+var loadCompounds = sync.OnceValue(func() *compounds {
+	c := &compounds{words: make(map[string]bool), prefixes: make(map[string]bool), suffixes: make(map[string]bool)}
+	scanner := bufio.NewScanner(strings.NewReader(builtinCompounds))
+	for scanner.Scan() {
+		entry := scanner.Text()
+		if i := strings.Index(entry, "#"); i >= 0 {
+			entry = entry[:i]
+		}
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		switch {
+		case entry == "" || entry == "-":
+		case strings.HasSuffix(entry, "-"):
+			c.prefixes[strings.TrimSuffix(entry, "-")] = true
+		case strings.HasPrefix(entry, "-"):
+			c.suffixes[strings.TrimPrefix(entry, "-")] = true
+		default:
+			c.words[entry] = true
+		}
+	}
+	return c
+})
+
+var (
+	wordPattern        = regexp.MustCompile(`\pL+(?:-\pL+)*`)
+	brokenWordPattern  = regexp.MustCompile(`(\pL(?:\pL|-\pL)*)-$`)
+	leadingWordPattern = regexp.MustCompile(`^[\pL\pN]+(?:-[\pL\pN]+)*`)
+	listMarkerPattern  = regexp.MustCompile(`^(?:[•·▪◦‣∙*–—\x{FFFD}-]\s|\(?(?:\d{1,3}|[a-zA-Z]|[ivxlcdm]{1,5})[.)]\s)`)
+)
+
+// reflower joins wrapped lines into paragraphs. It counts the words of the
+// whole document, so a word broken across a line can be checked against how
+// the document spells it elsewhere.
+type reflower struct {
+	vocabulary map[string]int
+	compounds  *compounds
+}
+
+func newReflower(pages []pageLinesOf) *reflower {
+	r := &reflower{vocabulary: make(map[string]int), compounds: loadCompounds()}
+	for _, page := range pages {
+		for _, l := range page.lines {
+			for _, word := range wordPattern.FindAllString(l.text, -1) {
+				r.vocabulary[strings.ToLower(word)]++
+			}
+		}
+	}
+	return r
+}
+
+// join appends the next line of a paragraph to text.
+func (r *reflower) join(text, next string) string {
+	if text == "" {
+		return next
+	}
+	separator, cut := r.separator(text, next)
+	return strings.TrimSuffix(text, cut) + separator + next
+}
+
+// separator decides how a line ending in text continues with next: a word
+// hyphenated at the line break is put back together, dropping the hyphen
+// (cut) unless the word is a hyphenated one; other lines are joined with a
+// space. List items stay on lines of their own.
+func (r *reflower) separator(text, next string) (separator, cut string) {
+	if listMarkerPattern.MatchString(next) {
+		return "\n", ""
+	}
+	if strings.HasSuffix(text, "\u00ad") {
+		return "", "\u00ad"
+	}
+	if head := brokenWordPattern.FindStringSubmatch(text); head != nil {
+		if tail := leadingWordPattern.FindString(next); tail != "" {
+			if r.keepHyphen(head[1], tail) {
+				return "", ""
+			}
+			return "", "-"
+		}
+	}
+	return " ", ""
+}
+
+// keepHyphen reports whether head and tail, split across lines after a
+// hyphen, form a hyphenated word rather than one word broken to fit the
+// line. Names and numbers ("Jean-Paul", "COVID-19") keep the hyphen, then
+// the document's own spelling decides, then the word list. Words found in
+// neither are joined, as most hyphens at line ends are breaks.
+func (r *reflower) keepHyphen(head, tail string) bool {
+	first, _ := utf8.DecodeRuneInString(tail)
+	if !unicode.IsLower(first) {
+		return true
+	}
+	head, tail = strings.ToLower(head), strings.ToLower(tail)
+	joined, hyphenated := head+tail, head+"-"+tail
+	switch {
+	case r.vocabulary[hyphenated] > 0 && r.vocabulary[hyphenated] >= r.vocabulary[joined]:
+		return true
+	case r.vocabulary[joined] > 0:
+		return false
+	case strings.Contains(head, "-"):
+		// Part of a longer compound, as in "state-of-the-" "art".
+		return true
+	}
+	lastPart := head[strings.LastIndex(head, "-")+1:]
+	firstPart, _, _ := strings.Cut(tail, "-")
+	return r.compounds.words[hyphenated] || r.compounds.prefixes[lastPart] || r.compounds.suffixes[firstPart]
+}
+
+// joinPages decides how a page continues with the next: after a blank line
+// unless the page ends mid-sentence, in which case the two are joined as
+// lines are.
+func (r *reflower) joinPages(previous, next string) (separator, cut string) {
+	if !continues(previous) {
+		return "\n\n", ""
+	}
+	return r.separator(lastLine(previous), firstLine(next))
+}
+
+// continues reports whether text clearly breaks off mid-sentence: after a
+// lowercase word, a comma or a hyphen. Text ending in a number, as a table of
+// contents does, is not taken to run on.
+func continues(text string) bool {
+	last, _ := utf8.DecodeLastRuneInString(text)
+	return unicode.IsLower(last) || strings.ContainsRune(",-\u00ad", last)
+}
+
+func lastLine(text string) string {
+	return text[strings.LastIndexByte(text, '\n')+1:]
+}
+
+func firstLine(text string) string {
+	line, _, _ := strings.Cut(text, "\n")
+	return line
+}
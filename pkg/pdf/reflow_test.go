@@ -0,0 +1,68 @@
+package pdf
+
+import "testing"
+
+func TestReflowJoin(t *testing.T) {
+	// The document spells "e-mail" with a hyphen and "cooperate" without.
+	r := newReflower([]pageLinesOf{testPage(1,
+		"Send an e-mail to the office.",
+		"We cooperate with the e-mail team.",
+	)})
+
+	tests := []struct {
+		name string
+		text string
+		next string
+		want string
+	}{
+		{"plain lines", "The results were", "clear.", "The results were clear."},
+		{"broken word", "This is incom-", "plete work.", "This is incomplete work."},
+		{"longer compound", "state-of-the-", "art methods", "state-of-the-art methods"},
+		{"name", "Jean-", "Paul Sartre", "Jean-Paul Sartre"},
+		{"number", "COVID-", "19 cases", "COVID-19 cases"},
+		{"prefix in word list", "a well-", "known fact", "a well-known fact"},
+		{"suffix in word list", "evidence-", "based care", "evidence-based care"},
+		{"whole word in word list", "a by-", "product of", "a by-product of"},
+		{"hyphenated in document", "by e-", "mail only", "by e-mail only"},
+		{"joined in document", "they co-", "operate well", "they cooperate well"},
+		{"soft hyphen", "an exam­", "ple here", "an example here"},
+		{"list item", "the following:", "• first point", "the following:\n• first point"},
+		{"numbered list item", "the steps are", "1. Open the file", "the steps are\n1. Open the file"},
+		{"empty text", "", "First line", "First line"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.join(tt.text, tt.next); got != tt.want {
+				t.Errorf("join(%q, %q) = %q, want %q", tt.text, tt.next, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJoinPages(t *testing.T) {
+	r := newReflower(nil)
+
+	tests := []struct {
+		name          string
+		previous      string
+		next          string
+		wantSeparator string
+		wantCut       string
+	}{
+		{"sentence ends", "The end.", "A new page", "\n\n", ""},
+		{"mid-sentence", "and so the", "story goes", " ", ""},
+		{"after a comma", "first,", "second", " ", ""},
+		{"broken word", "some incom-", "plete text", "", "-"},
+		{"table of contents", "Introduction 33", "Methods 41", "\n\n", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			separator, cut := r.joinPages(tt.previous, tt.next)
+			if separator != tt.wantSeparator || cut != tt.wantCut {
+				t.Errorf("joinPages(%q, %q) = %q, %q, want %q, %q", tt.previous, tt.next, separator, cut, tt.wantSeparator, tt.wantCut)
+			}
+		})
+	}
+}
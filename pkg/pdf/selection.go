@@ -0,0 +1,117 @@
+package pdf
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidSelection is returned by Extract when the selection does not
+// fit the document.
+var ErrInvalidSelection = errors.New("invalid page selection")
+
+// PageSpan is an inclusive range of page or outline entry numbers. A Last
+// of 0 means up to the end.
+type PageSpan struct {
+	First int
+	Last  int
+}
+
+// Selection limits extraction to part of a document. Pages lists page
+// numbers and Sections lists outline entries, numbered from 1 in the order
+// they appear; a section runs until the next entry at the same or a higher
+// level. An empty Selection keeps the whole document.
+type Selection struct {
+	Pages    []PageSpan
+	Sections []PageSpan
+}
+
+func (s *Selection) empty() bool {
+	return s == nil || (len(s.Pages) == 0 && len(s.Sections) == 0)
+}
+
+// ParseSpans parses a list like "12-80,95,120-".
+func ParseSpans(s string) ([]PageSpan, error) {
+	var spans []PageSpan
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		firstStr, lastStr, isRange := strings.Cut(part, "-")
+		first, err := strconv.Atoi(strings.TrimSpace(firstStr))
+		if err != nil || first < 1 {
+			return nil, fmt.Errorf("invalid range %q", part)
+		}
+		last := first
+		if isRange {
+			last = 0
+			if lastStr = strings.TrimSpace(lastStr); lastStr != "" {
+				last, err = strconv.Atoi(lastStr)
+				if err != nil || last < first {
+					return nil, fmt.Errorf("invalid range %q", part)
+				}
+			}
+		}
+		spans = append(spans, PageSpan{First: first, Last: last})
+	}
+	if len(spans) == 0 {
+		return nil, fmt.Errorf("empty range list %q", s)
+	}
+	return spans, nil
+}
+
+// pages resolves the selection to the set of page numbers to extract.
+func (s *Selection) pages(numPages int, outline []Section) (map[int]bool, error) {
+	selected := make(map[int]bool)
+	add := func(first, last int) {
+		for p := first; p <= last; p++ {
+			selected[p] = true
+		}
+	}
+
+	for _, span := range s.Pages {
+		last := span.Last
+		if last == 0 {
+			last = numPages
+		}
+		if span.First > numPages || last > numPages {
+			return nil, fmt.Errorf("%w: pages %d-%d, document has %d pages", ErrInvalidSelection, span.First, last, numPages)
+		}
+		add(span.First, last)
+	}
+
+	for _, span := range s.Sections {
+		last := span.Last
+		if last == 0 {
+			last = len(outline)
+		}
+		if span.First > len(outline) || last > len(outline) {
+			return nil, fmt.Errorf("%w: sections %d-%d, outline has %d entries", ErrInvalidSelection, span.First, last, len(outline))
+		}
+		for i := span.First - 1; i < last; i++ {
+			first, end := sectionPages(outline, i, numPages)
+			if first == 0 {
+				return nil, fmt.Errorf("%w: section %d %q has no page", ErrInvalidSelection, i+1, outline[i].Title)
+			}
+			add(first, end)
+		}
+	}
+	return selected, nil
+}
+
+// sectionPages returns the pages of outline entry i: from its page up to
+// the page before the next entry at the same or a higher level. Chapters
+// usually start on a new page; when the next entry starts on the same page,
+// that page alone is returned.
+func sectionPages(outline []Section, i, numPages int) (first, last int) {
+	first, last = outline[i].Page, numPages
+	for _, next := range outline[i+1:] {
+		if next.Level <= outline[i].Level && next.Page > 0 {
+			last = max(first, next.Page-1)
+			break
+		}
+	}
+	return first, last
+}
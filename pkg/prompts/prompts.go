@@ -0,0 +1,232 @@
+package prompts
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+const DefaultTemplate = "narrative-simple"
+
+//go:embed templates/*.tmpl
+var builtinTemplates embed.FS
+
+// Template is a named, versioned prompt. Template files are named
+// "<name>.v<version>.tmpl", e.g. "legal.v2.tmpl". A template that writes
+// output for a list mode declares it in a comment at the top of the file,
+// "{{- /* mode: notes */ -}}"; Mode is empty for prose templates.
+type Template struct {
+	Name    string
+	Version int
+	Mode    string
+	tmpl    *template.Template
+}
+
+var modePattern = regexp.MustCompile(`^\{\{-?\s*/\*\s*mode:\s*([a-z-]+)\s*\*/\s*-?\}\}`)
+
+// Data is the set of values available to a prompt template.
+type Data struct {
+	TargetWordCount int
+	ReadingLevel    string
+	Feedback        string
+	SourceLanguage  string
+	OutputLanguage  string
+	Translate       bool
+	Context         string
+	Markdown        bool
+	Placeholders    bool
+}
+
+type Registry struct {
+	templates map[string]map[int]*Template
+}
+
+func (t *Template) ID() string {
+	return fmt.Sprintf("%s@v%d", t.Name, t.Version)
+}
+
+func (t *Template) Render(data Data) (string, error) {
+	var buf bytes.Buffer
+	if err := t.tmpl.Execute(&buf, data); err != nil {
+		log.Printf("Failed to render prompt template %s: %v", t.ID(), err)
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// Uses reports whether the template refers to the named field of Data.
+// Older versions of a template predate some fields and leave them out.
+func (t *Template) Uses(field string) bool {
+	return usesField(t.tmpl.Tree.Root, field)
+}
+
+func usesField(node parse.Node, field string) bool {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return false
+		}
+		for _, child := range n.Nodes {
+			if usesField(child, field) {
+				return true
+			}
+		}
+	case *parse.ActionNode:
+		return usesField(n.Pipe, field)
+	case *parse.IfNode:
+		return usesField(n.Pipe, field) || usesField(n.List, field) || usesField(n.ElseList, field)
+	case *parse.RangeNode:
+		return usesField(n.Pipe, field) || usesField(n.List, field) || usesField(n.ElseList, field)
+	case *parse.WithNode:
+		return usesField(n.Pipe, field) || usesField(n.List, field) || usesField(n.ElseList, field)
+	case *parse.PipeNode:
+		if n == nil {
+			return false
+		}
+		for _, cmd := range n.Cmds {
+			for _, arg := range cmd.Args {
+				if usesField(arg, field) {
+					return true
+				}
+			}
+		}
+	case *parse.FieldNode:
+		return len(n.Ident) > 0 && n.Ident[0] == field
+	}
+	return false
+}
+
+// Load reads the built-in templates and then any templates found in dir.
+// Templates in dir override built-in templates with the same name and version.
+func Load(dir string) (*Registry, error) {
+	log.Println("Loading prompt templates")
+	r := &Registry{templates: make(map[string]map[int]*Template)}
+
+	if err := r.loadFS(builtinTemplates, "templates"); err != nil {
+		return nil, err
+	}
+
+	if dir != "" {
+		log.Printf("Loading prompt templates from %s", dir)
+		if err := r.loadFS(os.DirFS(dir), "."); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, name := range r.Names() {
+		t := r.latest(name)
+		if t.Mode != "" {
+			log.Printf("Prompt template available: %s (%s mode)", t.ID(), t.Mode)
+			continue
+		}
+		log.Printf("Prompt template available: %s", t.ID())
+	}
+	return r, nil
+}
+
+func (r *Registry) loadFS(fsys fs.FS, dir string) error {
+	matches, err := fs.Glob(fsys, filepath.ToSlash(filepath.Join(dir, "*.tmpl")))
+	if err != nil {
+		return err
+	}
+
+	for _, path := range matches {
+		name, version, err := parseFilename(filepath.Base(path))
+		if err != nil {
+			return err
+		}
+
+		content, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			log.Printf("Failed to read prompt template %s: %v", path, err)
+			return err
+		}
+
+		tmpl, err := template.New(name).Option("missingkey=error").Parse(string(content))
+		if err != nil {
+			log.Printf("Failed to parse prompt template %s: %v", path, err)
+			return fmt.Errorf("parse prompt template %s: %w", path, err)
+		}
+
+		if r.templates[name] == nil {
+			r.templates[name] = make(map[int]*Template)
+		}
+		t := &Template{Name: name, Version: version, tmpl: tmpl}
+		if m := modePattern.FindStringSubmatch(string(content)); m != nil {
+			t.Mode = m[1]
+		}
+		r.templates[name][version] = t
+	}
+	return nil
+}
+
+func parseFilename(filename string) (string, int, error) {
+	base := strings.TrimSuffix(filename, ".tmpl")
+	idx := strings.LastIndex(base, ".v")
+	if idx <= 0 {
+		return "", 0, fmt.Errorf("prompt template %q is not named <name>.v<version>.tmpl", filename)
+	}
+
+	version, err := strconv.Atoi(base[idx+2:])
+	if err != nil || version <= 0 {
+		return "", 0, fmt.Errorf("prompt template %q has an invalid version", filename)
+	}
+	return base[:idx], version, nil
+}
+
+// Get resolves a template selector of the form "name" (latest version)
+// or "name@vN" / "name@N" (a specific version).
+func (r *Registry) Get(selector string) (*Template, error) {
+	if selector == "" {
+		selector = DefaultTemplate
+	}
+
+	name, versionStr, pinned := strings.Cut(selector, "@")
+	versions, ok := r.templates[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown prompt template %q", name)
+	}
+
+	if !pinned {
+		return r.latest(name), nil
+	}
+
+	version, err := strconv.Atoi(strings.TrimPrefix(versionStr, "v"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid prompt template version %q", versionStr)
+	}
+	t, ok := versions[version]
+	if !ok {
+		return nil, fmt.Errorf("prompt template %q has no version %d", name, version)
+	}
+	return t, nil
+}
+
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.templates))
+	for name := range r.templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (r *Registry) latest(name string) *Template {
+	var latest *Template
+	for _, t := range r.templates[name] {
+		if latest == nil || t.Version > latest.Version {
+			latest = t
+		}
+	}
+	return latest
+}
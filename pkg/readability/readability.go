@@ -0,0 +1,169 @@
+package readability
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type Stats struct {
+	Words              int     `json:"words"`
+	Sentences          int     `json:"sentences"`
+	Syllables          int     `json:"syllables"`
+	FleschReadingEase  float64 `json:"flesch_reading_ease"`
+	FleschKincaidGrade float64 `json:"flesch_kincaid_grade"`
+}
+
+// Level is a requested reading level, expressed either as a US school
+// grade or as a CEFR level that is mapped onto an approximate grade.
+type Level struct {
+	Label string
+	Grade float64
+	CEFR  string
+}
+
+var cefrGrades = map[string]float64{
+	"A1": 2,
+	"A2": 4,
+	"B1": 6,
+	"B2": 8,
+	"C1": 11,
+	"C2": 14,
+}
+
+var cefrDescriptions = map[string]string{
+	"A1": "beginner: very common words and very short sentences",
+	"A2": "elementary: common everyday words and short sentences",
+	"B1": "intermediate: everyday vocabulary and mostly simple sentences",
+	"B2": "upper intermediate: varied vocabulary and some complex sentences",
+	"C1": "advanced: precise vocabulary and complex sentences where needed",
+	"C2": "proficient: the full range of vocabulary and sentence structure",
+}
+
+// ParseLevel accepts a grade ("5", "grade 5", "grade:5") or a CEFR level ("B1").
+func ParseLevel(s string) (*Level, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+
+	cefr := strings.ToUpper(s)
+	if grade, ok := cefrGrades[cefr]; ok {
+		return &Level{Label: cefr, Grade: grade, CEFR: cefr}, nil
+	}
+
+	gradeStr := strings.TrimSpace(strings.TrimLeft(strings.TrimPrefix(strings.ToLower(s), "grade"), ": "))
+	grade, err := strconv.ParseFloat(gradeStr, 64)
+	if err != nil || grade < 1 || grade > 18 {
+		return nil, fmt.Errorf("invalid reading level %q: use a grade between 1 and 18 or a CEFR level A1-C2", s)
+	}
+	return &Level{Label: fmt.Sprintf("grade %g", grade), Grade: grade}, nil
+}
+
+// Description is the wording used in prompts to describe the level.
+func (l *Level) Description() string {
+	if l.CEFR != "" {
+		return fmt.Sprintf("CEFR level %s (%s)", l.CEFR, cefrDescriptions[l.CEFR])
+	}
+	age := int(math.Round(l.Grade)) + 5
+	return fmt.Sprintf("a US grade %g reading level (readers aged about %d)", l.Grade, age)
+}
+
+// Matches reports whether a text with the given Flesch-Kincaid grade is close
+// enough to the level. Text that is too hard must be within tolerance grades;
+// text that is too easy is allowed twice the tolerance, since the formula
+// scores short condensed sentences very low.
+func (l *Level) Matches(grade, tolerance float64) bool {
+	return grade <= l.Grade+tolerance && grade >= l.Grade-2*tolerance
+}
+
+func Analyze(text string) Stats {
+	var stats Stats
+
+	for _, word := range strings.Fields(text) {
+		word = strings.TrimFunc(word, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		})
+		if word == "" {
+			continue
+		}
+		stats.Words++
+		stats.Syllables += countSyllables(word)
+	}
+	stats.Sentences = countSentences(text)
+	return stats.scored()
+}
+
+// Merge combines the statistics of consecutive pieces of a text, such as the
+// chunks of a streamed document, into the statistics of the whole text.
+func Merge(pieces ...Stats) Stats {
+	var stats Stats
+	for _, p := range pieces {
+		stats.Words += p.Words
+		stats.Sentences += p.Sentences
+		stats.Syllables += p.Syllables
+	}
+	return stats.scored()
+}
+
+// scored fills in the Flesch scores from the counts.
+func (stats Stats) scored() Stats {
+	if stats.Words == 0 || stats.Sentences == 0 {
+		return stats
+	}
+
+	wordsPerSentence := float64(stats.Words) / float64(stats.Sentences)
+	syllablesPerWord := float64(stats.Syllables) / float64(stats.Words)
+	stats.FleschReadingEase = round(206.835 - 1.015*wordsPerSentence - 84.6*syllablesPerWord)
+	stats.FleschKincaidGrade = round(math.Max(0, 0.39*wordsPerSentence+11.8*syllablesPerWord-15.59))
+	return stats
+}
+
+func countSentences(text string) int {
+	count := 0
+	inSentence := false
+	for _, r := range text {
+		switch {
+		case strings.ContainsRune(".!?。！？।؟", r):
+			if inSentence {
+				count++
+			}
+			inSentence = false
+		case unicode.IsLetter(r) || unicode.IsNumber(r):
+			inSentence = true
+		}
+	}
+	if inSentence {
+		count++
+	}
+	return count
+}
+
+// countSyllables approximates English syllables by counting vowel groups,
+// ignoring a silent trailing "e".
+func countSyllables(word string) int {
+	word = strings.ToLower(word)
+	count := 0
+	prevVowel := false
+	for _, r := range word {
+		vowel := strings.ContainsRune("aeiouy", r)
+		if vowel && !prevVowel {
+			count++
+		}
+		prevVowel = vowel
+	}
+
+	if strings.HasSuffix(word, "e") && !strings.HasSuffix(word, "le") && count > 1 {
+		count--
+	}
+	if count == 0 {
+		count = 1
+	}
+	return count
+}
+
+func round(v float64) float64 {
+	return math.Round(v*10) / 10
+}
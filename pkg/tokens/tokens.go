@@ -0,0 +1,69 @@
+package tokens
+
+import "unicode"
+
+// Estimate approximates the number of tokens a subword tokenizer produces
+// for text. Runs of letters count as one token per four characters (at least
+// one per word), runs of digits as one token per three digits, every
+// ideograph, kana or hangul syllable and every punctuation or symbol
+// character as a token of its own. Whitespace is free. The estimate errs on
+// the high side for English prose and is close for code and CJK text, where
+// word counts are most misleading.
+func Estimate(text string) int {
+	count := 0
+	letters, digits := 0, 0
+
+	flush := func() {
+		count += (letters + 3) / 4
+		count += (digits + 2) / 3
+		letters, digits = 0, 0
+	}
+
+	for _, r := range text {
+		switch {
+		case isLogographic(r):
+			flush()
+			count++
+		case unicode.IsLetter(r) || unicode.IsMark(r):
+			if digits > 0 {
+				flush()
+			}
+			letters++
+		case unicode.IsDigit(r):
+			if letters > 0 {
+				flush()
+			}
+			digits++
+		case unicode.IsSpace(r):
+			flush()
+		default:
+			flush()
+			count++
+		}
+	}
+	flush()
+	return count
+}
+
+// Budget returns the largest input, in tokens, that can be sent to a model
+// with the given context window and output limit, when the prompt itself
+// takes promptTokens and the output is expected to be ratio times the input.
+// The output estimate gets a 25% allowance since models overshoot word
+// targets. The result is never below one token.
+func Budget(contextWindow, maxOutput, promptTokens int, ratio float64) int {
+	const outputAllowance = 1.25
+
+	budget := float64(contextWindow-promptTokens) / (1 + ratio*outputAllowance)
+	if ratio > 0 && maxOutput > 0 {
+		budget = min(budget, float64(maxOutput)/(ratio*outputAllowance))
+	}
+	if budget < 1 {
+		return 1
+	}
+	return int(budget)
+}
+
+func isLogographic(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r)
+}
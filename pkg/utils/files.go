@@ -63,12 +63,28 @@ func GetSafeFilename(original string) string {
 	ext := filepath.Ext(base)
 	name := strings.TrimSuffix(base, ext)
 
-	safe := strings.Map(func(r rune) rune {
+	return SafeName(name) + "-processed.txt"
+}
+
+func SafeName(name string) string {
+	return strings.Map(func(r rune) rune {
 		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' || r == '_' {
 			return r
 		}
 		return '-'
 	}, name)
+}
 
-	return safe + "-processed.txt"
+// Slug turns a title into a lowercase file name stem of at most 60
+// characters, or "" if nothing of the title is left.
+func Slug(title string) string {
+	parts := strings.FieldsFunc(SafeName(strings.ToLower(title)), func(r rune) bool { return r == '-' })
+	slug := strings.Join(parts, "-")
+	if len(slug) > 60 {
+		slug = strings.TrimRight(slug[:60], "-_")
+		if i := strings.LastIndexByte(slug, '-'); i > 30 {
+			slug = slug[:i]
+		}
+	}
+	return slug
 }
@@ -2,44 +2,151 @@ package workers
 
 import (
 	"context"
+	"fmt"
+	"iter"
 	"log"
 	"pdf-processor/internal/api"
+	"pdf-processor/internal/chunker"
 	"pdf-processor/internal/config"
+	"pdf-processor/internal/langdetect"
+	"pdf-processor/internal/prompts"
+	"pdf-processor/internal/readability"
+	"pdf-processor/internal/tokens"
 	"strings"
 	"sync"
 	"time"
 )
 
-func ProcessChunks(ctx context.Context, chunks []string, cfg *config.Config, ratio float64) []string {
-	startTime := time.Now()
+type Options struct {
+	Ratio          float64
+	Template       *prompts.Template
+	ReadingLevel   *readability.Level
+	SourceLanguage langdetect.Language
+	TargetLanguage langdetect.Language
+	Markdown       bool
+}
 
-	totalInputWords := 0
-	for _, chunk := range chunks {
-		totalInputWords += len(strings.Fields(chunk))
+// Result describes one processed chunk. StartWord and EndWord give the
+// chunk's position in the input as a half-open range of word offsets;
+// Start and End are the chunk's character offsets in the source text, as
+// set by chunker.LocateChunks.
+type Result struct {
+	Index             int
+	Chapter           int
+	StartWord         int
+	EndWord           int
+	Start             int
+	End               int
+	Content           string
+	InputWords        int
+	OutputWords       int
+	Template          string
+	Model             string
+	FinishReason      string
+	Usage             api.Usage
+	Attempts          int
+	Duration          time.Duration
+	InputReadability  readability.Stats
+	OutputReadability readability.Stats
+	Error             string
+}
+
+// overlapWordsPerSentence is the length of a long sentence, used to reserve
+// room for the overlap context before the chunks are known.
+const overlapWordsPerSentence = 40
+
+// ChunkTokens returns the token budget for a chunk: the largest input that
+// fits the model's context window together with the rendered prompt, the
+// overlap context and the output requested by opts.Ratio, capped at
+// cfg.ChunkTokens when that is set.
+func ChunkTokens(cfg *config.Config, opts Options) (int, error) {
+	model := api.LookupModel(cfg.Model)
+
+	data := prompts.Data{
+		TargetWordCount: 1000,
+		SourceLanguage:  opts.SourceLanguage.Name,
+		OutputLanguage:  opts.TargetLanguage.Name,
+		Translate:       true,
+		Markdown:        opts.Markdown,
+		Placeholders:    opts.Markdown,
+	}
+	if opts.ReadingLevel != nil {
+		data.ReadingLevel = opts.ReadingLevel.Description()
+		// Leave room for the feedback added when re-prompting.
+		data.Feedback = strings.Repeat("word ", 60)
+	}
+	if cfg.ChunkOverlap > 0 {
+		// Leave room for the context sentences sent with each chunk.
+		data.Context = strings.Repeat("word ", overlapWordsPerSentence*cfg.ChunkOverlap)
+	}
+	prompt, err := opts.Template.Render(data)
+	if err != nil {
+		return 0, err
 	}
 
-	log.Printf("Starting to process %d chunks with max concurrency %d (total input: %d words)",
-		len(chunks), cfg.MaxConcurrent, totalInputWords)
+	budget := tokens.Budget(model.ContextWindow, model.MaxOutputTokens, tokens.Estimate(prompt), opts.Ratio)
+	log.Printf("Model %s (context window %d, max output %d tokens) allows chunks of %d tokens at ratio %.2f",
+		model.Name, model.ContextWindow, model.MaxOutputTokens, budget, opts.Ratio)
+	if cfg.ChunkTokens > 0 && cfg.ChunkTokens < budget {
+		budget = cfg.ChunkTokens
+	}
+	return budget, nil
+}
+
+func ProcessChunks(ctx context.Context, chunks []chunker.Chunk, cfg *config.Config, opts Options) []Result {
+	results, _ := ProcessStream(ctx, func(yield func(chunker.Chunk, error) bool) {
+		for _, chunk := range chunks {
+			if !yield(chunk, nil) {
+				return
+			}
+		}
+	}, cfg, opts)
+	return results
+}
+
+// ProcessStream processes chunks as they arrive, so that condensing starts
+// before the whole input has been chunked. Results are returned in chunk
+// order once every chunk has been processed. If the stream yields an error,
+// no further chunks are dispatched and the error is returned together with
+// the results of the chunks already dispatched.
+func ProcessStream(ctx context.Context, chunks iter.Seq2[chunker.Chunk, error], cfg *config.Config, opts Options) ([]Result, error) {
+	startTime := time.Now()
+
+	log.Printf("Starting to process chunks with max concurrency %d and prompt template %s", cfg.MaxConcurrent, opts.Template.ID())
+
+	type indexedResult struct {
+		index  int
+		result Result
+	}
 
 	var (
 		wg         sync.WaitGroup
-		results    = make([]string, len(chunks))
+		results    []Result
+		streamErr  error
 		semaphore  = make(chan struct{}, cfg.MaxConcurrent)
-		resultChan = make(chan struct {
-			index   int
-			content string
-		})
+		resultChan = make(chan indexedResult)
 	)
 
 	go func() {
-		log.Printf("Worker goroutine started, will process %d chunks", len(chunks))
-		for i, chunk := range chunks {
+		log.Println("Worker goroutine started")
+		totalInputWords := 0
+		i := 0
+		for chunk, err := range chunks {
+			if err != nil {
+				log.Printf("Chunk stream failed after %d chunks: %v", i, err)
+				streamErr = err
+				break
+			}
+
+			chunkWords := chunkWordCount(chunk)
+			startWord := totalInputWords
+			totalInputWords += chunkWords
+
 			wg.Add(1)
 			semaphore <- struct{}{}
-			chunkWords := len(strings.Fields(chunk))
-			log.Printf("Dispatching worker for chunk %d/%d (size: %d words)", i+1, len(chunks), chunkWords)
+			log.Printf("Dispatching worker for chunk %d (size: %d words)", i+1, chunkWords)
 
-			go func(index int, text string) {
+			go func(index int, chunk chunker.Chunk) {
 				chunkStartTime := time.Now()
 				defer func() {
 					<-semaphore
@@ -47,28 +154,26 @@ func ProcessChunks(ctx context.Context, chunks []string, cfg *config.Config, rat
 					log.Printf("Worker for chunk %d completed in %v", index, time.Since(chunkStartTime))
 				}()
 
-				inputWords := len(strings.Fields(text))
-				log.Printf("Processing chunk %d (%d words)", index, inputWords)
-
-				targetWordCount := int(float64(cfg.ChunkSize) * ratio)
-				if targetWordCount <= 0 {
-					targetWordCount = 1
-				}
+				log.Printf("Processing chunk %d (%d words, %d words of context)", index, chunkWords, chunker.WordCount(chunk.Context))
 
-				content, err := api.ProcessText(ctx, text, cfg.OpenRouterKey, targetWordCount)
+				result, err := processChunk(ctx, index, chunk, cfg, opts)
 				if err != nil {
 					log.Printf("Error processing chunk %d: %v", index, err)
+					result.Error = err.Error()
 				} else {
-					outputWords := len(strings.Fields(content))
-					log.Printf("Successfully processed chunk %d, result: %d words", index, outputWords)
-					resultChan <- struct {
-						index   int
-						content string
-					}{index, content}
+					log.Printf("Successfully processed chunk %d, result: %d words", index, result.OutputWords)
 				}
+				result.Index = index
+				result.Chapter = chunk.Chapter
+				result.StartWord = startWord
+				result.EndWord = startWord + chunkWords
+				result.Start, result.End = chunk.Start, chunk.End
+				result.Duration = time.Since(chunkStartTime)
+				resultChan <- indexedResult{index, result}
 			}(i, chunk)
+			i++
 		}
-		log.Println("All workers dispatched, waiting for completion")
+		log.Printf("All %d workers dispatched, waiting for completion", i)
 		wg.Wait()
 		log.Println("All workers completed, closing result channel")
 		close(resultChan)
@@ -78,17 +183,21 @@ func ProcessChunks(ctx context.Context, chunks []string, cfg *config.Config, rat
 	resultCount := 0
 	for res := range resultChan {
 		resultCount++
-		resultWords := len(strings.Fields(res.content))
-		log.Printf("Received result %d/%d for chunk %d (%d words)", resultCount, len(chunks), res.index, resultWords)
-		results[res.index] = res.content
+		log.Printf("Received result %d for chunk %d (%d words)", resultCount, res.index, res.result.OutputWords)
+		if res.index >= len(results) {
+			results = append(results, make([]Result, res.index+1-len(results))...)
+		}
+		results[res.index] = res.result
 	}
 
 	validResults := 0
+	totalInputWords := 0
 	totalOutputWords := 0
 	for _, r := range results {
-		if r != "" {
+		totalInputWords += r.InputWords
+		if r.Content != "" {
 			validResults++
-			totalOutputWords += len(strings.Fields(r))
+			totalOutputWords += r.OutputWords
 		}
 	}
 
@@ -98,9 +207,105 @@ func ProcessChunks(ctx context.Context, chunks []string, cfg *config.Config, rat
 	}
 
 	log.Printf("Processing completed in %v, received %d valid results out of %d chunks",
-		time.Since(startTime), validResults, len(chunks))
+		time.Since(startTime), validResults, len(results))
 	log.Printf("Total input: %d words, total output: %d words (%.1f%% reduction)",
 		totalInputWords, totalOutputWords, reductionPercent)
 
-	return results
+	return results, streamErr
+}
+
+// processChunk condenses a single chunk. When a reading level is requested,
+// the chunk is re-prompted up to cfg.ReadabilityRetries times if the output
+// misses the level by more than cfg.ReadabilityTolerance grades. The chunk's
+// context, if any, is passed to the prompt as reference only.
+func processChunk(ctx context.Context, index int, chunk chunker.Chunk, cfg *config.Config, opts Options) (Result, error) {
+	text := chunk.Text
+	inputWords := chunkWordCount(chunk)
+	targetWordCount := int(float64(inputWords) * opts.Ratio)
+	if targetWordCount <= 0 {
+		targetWordCount = 1
+	}
+
+	data := prompts.Data{
+		TargetWordCount: targetWordCount,
+		SourceLanguage:  opts.SourceLanguage.Name,
+		OutputLanguage:  opts.TargetLanguage.Name,
+		Translate:       opts.TargetLanguage.Code != opts.SourceLanguage.Code && opts.SourceLanguage != langdetect.Unknown,
+		Context:         chunk.Context,
+		Markdown:        opts.Markdown,
+		Placeholders:    len(chunk.Verbatim) > 0,
+	}
+	if opts.ReadingLevel != nil {
+		data.ReadingLevel = opts.ReadingLevel.Description()
+	}
+
+	// The Flesch-Kincaid formulas are calibrated for English only.
+	checkReadability := opts.ReadingLevel != nil && opts.TargetLanguage.Code == "en"
+
+	result := Result{
+		InputWords:       inputWords,
+		Template:         opts.Template.ID(),
+		InputReadability: readability.Analyze(text),
+	}
+
+	for {
+		prompt, err := opts.Template.Render(data)
+		if err != nil {
+			return result, err
+		}
+
+		completion, err := api.ProcessText(ctx, cfg.Model, text, prompt, cfg.OpenRouterKey)
+		if err != nil {
+			if result.Attempts > 0 {
+				log.Printf("Re-prompting chunk %d failed, keeping previous result: %v", index, err)
+				return result, nil
+			}
+			return result, err
+		}
+		result.Attempts++
+		if opts.Template.Mode == "" {
+			result.Content = chunk.Restore(completion.Text)
+		} else {
+			// The list modes leave code blocks and tables out.
+			result.Content = chunker.DropVerbatim(completion.Text)
+		}
+		result.OutputWords = chunker.WordCount(completion.Text)
+		result.Model = completion.Model
+		result.FinishReason = completion.FinishReason
+		result.Usage.Add(completion.Usage)
+		result.OutputReadability = readability.Analyze(completion.Text)
+
+		if !checkReadability {
+			return result, nil
+		}
+
+		grade := result.OutputReadability.FleschKincaidGrade
+		if opts.ReadingLevel.Matches(grade, cfg.ReadabilityTolerance) {
+			log.Printf("Chunk %d output at grade %.1f matches reading level %s", index, grade, opts.ReadingLevel.Label)
+			return result, nil
+		}
+		if result.Attempts > cfg.ReadabilityRetries {
+			log.Printf("Chunk %d output at grade %.1f still misses reading level %s after %d attempts, keeping last result",
+				index, grade, opts.ReadingLevel.Label, result.Attempts)
+			return result, nil
+		}
+
+		log.Printf("Chunk %d output at grade %.1f misses reading level %s (grade %g), re-prompting",
+			index, grade, opts.ReadingLevel.Label, opts.ReadingLevel.Grade)
+		direction := "simpler, with shorter sentences and more common words"
+		if grade < opts.ReadingLevel.Grade {
+			direction = "less simplistic, with fuller sentences and more precise vocabulary"
+		}
+		data.Feedback = fmt.Sprintf("Note: a previous attempt read at about US grade %.1f, which misses the requested level of grade %g. Make the language %s.",
+			grade, opts.ReadingLevel.Grade, direction)
+	}
+}
+
+// chunkWordCount returns the size of a chunk in words as the chunker counted
+// them, counting each CJK character as a word.
+func chunkWordCount(chunk chunker.Chunk) int {
+	if chunk.Words > 0 {
+		return chunk.Words
+	}
+	return chunker.WordCount(chunk.Text)
 }
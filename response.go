@@ -0,0 +1,491 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"pdf-processor/internal/api"
+	"pdf-processor/internal/chunker"
+	"pdf-processor/internal/combiner"
+	"pdf-processor/internal/langdetect"
+	"pdf-processor/internal/pdf"
+	"pdf-processor/internal/readability"
+	"pdf-processor/internal/utils"
+	"pdf-processor/internal/workers"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type jobMetadata struct {
+	Title          string              `json:"title,omitempty"`
+	Mode           combiner.Mode       `json:"mode"`
+	Template       string              `json:"template"`
+	ReadingLevel   string              `json:"reading_level,omitempty"`
+	SourceLanguage langdetect.Result   `json:"source_language"`
+	TargetLanguage langdetect.Language `json:"target_language"`
+	Document       *documentMetadata   `json:"document,omitempty"`
+}
+
+// documentMetadata describes an uploaded PDF and the part of it that was
+// selected.
+type documentMetadata struct {
+	Pages          int            `json:"pages"`
+	ExtractedPages int            `json:"extracted_pages"`
+	PageSelection  string         `json:"page_selection,omitempty"`
+	Sections       string         `json:"sections,omitempty"`
+	Author         string         `json:"author,omitempty"`
+	Subject        string         `json:"subject,omitempty"`
+	Removed        []removedLines `json:"removed"`
+}
+
+// removedLines reports a running header, footer or page number that was
+// stripped from the PDF text.
+type removedLines struct {
+	Kind  string `json:"kind"`
+	Text  string `json:"text"`
+	Pages int    `json:"pages"`
+}
+
+type sourceRange struct {
+	StartWord int `json:"start_word"`
+	EndWord   int `json:"end_word"`
+}
+
+// pageRange is the span of PDF pages a piece of text came from.
+type pageRange struct {
+	First int `json:"first"`
+	Last  int `json:"last"`
+}
+
+// span widens r to cover other.
+func (r *pageRange) span(other *pageRange) *pageRange {
+	if r == nil {
+		return other
+	}
+	if other == nil {
+		return r
+	}
+	return &pageRange{First: min(r.First, other.First), Last: max(r.Last, other.Last)}
+}
+
+type readabilityPair struct {
+	Input  readability.Stats `json:"input"`
+	Output readability.Stats `json:"output"`
+}
+
+type chunkResponse struct {
+	Index        int             `json:"index"`
+	Chapter      int             `json:"chapter"`
+	SourceRange  sourceRange     `json:"source_range"`
+	Pages        *pageRange      `json:"pages,omitempty"`
+	Content      string          `json:"content"`
+	InputWords   int             `json:"input_words"`
+	OutputWords  int             `json:"output_words"`
+	Template     string          `json:"template"`
+	Model        string          `json:"model,omitempty"`
+	FinishReason string          `json:"finish_reason,omitempty"`
+	Usage        api.Usage       `json:"usage"`
+	Attempts     int             `json:"attempts"`
+	DurationMS   int64           `json:"duration_ms"`
+	Readability  readabilityPair `json:"readability"`
+	Error        string          `json:"error,omitempty"`
+}
+
+type totalsResponse struct {
+	Chunks           int             `json:"chunks"`
+	ProcessedChunks  int             `json:"processed_chunks"`
+	FailedChunks     int             `json:"failed_chunks"`
+	InputWords       int             `json:"input_words"`
+	OutputWords      int             `json:"output_words"`
+	ReductionPercent float64         `json:"reduction_percent"`
+	Usage            api.Usage       `json:"usage"`
+	DurationMS       int64           `json:"duration_ms"`
+	Readability      readabilityPair `json:"readability"`
+}
+
+type chapterResponse struct {
+	Index   int        `json:"index"`
+	Title   string     `json:"title"`
+	Pages   *pageRange `json:"pages,omitempty"`
+	Content string     `json:"content"`
+	Chunks  []int      `json:"chunks"`
+}
+
+// paragraphResponse is a paragraph of condensed output with the chunk it
+// came from and the pages of the source paragraphs it condenses, so that it
+// can be traced back to the source.
+type paragraphResponse struct {
+	Chunk   int        `json:"chunk"`
+	Chapter int        `json:"chapter"`
+	Pages   *pageRange `json:"pages,omitempty"`
+	Text    string     `json:"text"`
+}
+
+type processResponse struct {
+	Content    string               `json:"content"`
+	Flashcards []combiner.Flashcard `json:"flashcards,omitempty"`
+	Job        jobMetadata          `json:"job"`
+	Chapters   []chapterResponse    `json:"chapters"`
+	Chunks     []chunkResponse      `json:"chunks"`
+	Paragraphs []paragraphResponse  `json:"paragraphs"`
+	Totals     totalsResponse       `json:"totals"`
+}
+
+// pageLookup returns the PDF pages covering a character range of the
+// source text, or nil if there are none.
+type pageLookup func(start, end int) *pageRange
+
+// sourceParagraph is a paragraph of the source text, by character offsets,
+// with the words it uses.
+type sourceParagraph struct {
+	start, end int
+	words      map[string]bool
+}
+
+// paragraphPages maps the paragraphs of a chunk's output to the pages of the
+// source paragraphs they condense. Output paragraphs are matched in order to
+// the source paragraph that shares the most words with them, and each covers
+// the source from after the previous match through its own. A paragraph that
+// shares too few words with the source, as a translation does, is placed by
+// its relative position in the output instead.
+func paragraphPages(source []rune, start, end int, outputs []string, pages pageLookup) []*pageRange {
+	start, end = min(start, len(source)), min(end, len(source))
+	var paragraphs []sourceParagraph
+	offset := start
+	for _, text := range strings.Split(string(source[start:end]), "\n\n") {
+		length := utf8.RuneCountInString(text)
+		if strings.TrimSpace(text) != "" {
+			paragraphs = append(paragraphs, sourceParagraph{start: offset, end: offset + length, words: paragraphWords(text)})
+		}
+		offset += length + 2
+	}
+
+	ranges := make([]*pageRange, len(outputs))
+	if len(paragraphs) == 0 {
+		for i := range ranges {
+			ranges[i] = pages(start, end)
+		}
+		return ranges
+	}
+
+	total := 0
+	for _, output := range outputs {
+		total += utf8.RuneCountInString(output)
+	}
+	previous, position := -1, 0
+	for i, output := range outputs {
+		match, best := -1, 1
+		words := paragraphWords(output)
+		for k := max(previous, 0); k < len(paragraphs); k++ {
+			shared := 0
+			for word := range words {
+				if paragraphs[k].words[word] {
+					shared++
+				}
+			}
+			if shared > best {
+				match, best = k, shared
+			}
+		}
+		length := utf8.RuneCountInString(output)
+		if match < 0 {
+			match = max(previous, min((position+length/2)*len(paragraphs)/max(total, 1), len(paragraphs)-1))
+		}
+		position += length
+
+		first := match
+		if previous < match {
+			first = previous + 1
+		}
+		ranges[i] = pages(paragraphs[first].start, paragraphs[match].end)
+		previous = match
+	}
+	return ranges
+}
+
+// paragraphWords returns the lowercased words of text long enough to say
+// something about where it came from.
+func paragraphWords(text string) map[string]bool {
+	words := make(map[string]bool)
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}) {
+		if utf8.RuneCountInString(word) >= 4 {
+			words[word] = true
+		}
+	}
+	return words
+}
+
+func newProcessResponse(job jobMetadata, overlap int, content string, chapters []chunker.Chapter, sections []combiner.Section, results []workers.Result, source string, pages pageLookup, totals totalsResponse) processResponse {
+	resp := processResponse{
+		Content:    content,
+		Job:        job,
+		Chapters:   make([]chapterResponse, 0, len(chapters)),
+		Chunks:     make([]chunkResponse, 0, len(results)),
+		Paragraphs: []paragraphResponse{},
+		Totals:     totals,
+	}
+
+	for i, chapter := range chapters {
+		ch := chapterResponse{
+			Index:   chapter.Index,
+			Title:   chapter.Title,
+			Content: combiner.Combine(job.Mode, []combiner.Section{{Parts: sections[i].Parts}}, overlap),
+			Chunks:  []int{},
+		}
+		for _, res := range results {
+			if res.Chapter == chapter.Index {
+				ch.Chunks = append(ch.Chunks, res.Index)
+				ch.Pages = ch.Pages.span(pages(res.Start, res.End))
+			}
+		}
+		resp.Chapters = append(resp.Chapters, ch)
+	}
+
+	var sourceRunes []rune
+	var parts []string
+	for _, res := range results {
+		chunkPages := pages(res.Start, res.End)
+		resp.Chunks = append(resp.Chunks, chunkResponse{
+			Index:        res.Index,
+			Chapter:      res.Chapter,
+			SourceRange:  sourceRange{StartWord: res.StartWord, EndWord: res.EndWord},
+			Pages:        chunkPages,
+			Content:      res.Content,
+			InputWords:   res.InputWords,
+			OutputWords:  res.OutputWords,
+			Template:     res.Template,
+			Model:        res.Model,
+			FinishReason: res.FinishReason,
+			Usage:        res.Usage,
+			Attempts:     res.Attempts,
+			DurationMS:   res.Duration.Milliseconds(),
+			Readability:  readabilityPair{Input: res.InputReadability, Output: res.OutputReadability},
+			Error:        res.Error,
+		})
+
+		resp.Totals.Chunks++
+		if res.Error != "" {
+			resp.Totals.FailedChunks++
+			continue
+		}
+		resp.Totals.ProcessedChunks++
+		resp.Totals.Usage.Add(res.Usage)
+		parts = append(parts, res.Content)
+
+		var paragraphs []string
+		for _, paragraph := range strings.Split(res.Content, "\n\n") {
+			if paragraph = strings.TrimSpace(paragraph); paragraph != "" {
+				paragraphs = append(paragraphs, paragraph)
+			}
+		}
+		paragraphRanges := make([]*pageRange, len(paragraphs))
+		if chunkPages != nil {
+			if sourceRunes == nil {
+				sourceRunes = []rune(source)
+			}
+			paragraphRanges = paragraphPages(sourceRunes, res.Start, res.End, paragraphs, pages)
+		}
+		for i, paragraph := range paragraphs {
+			resp.Paragraphs = append(resp.Paragraphs, paragraphResponse{
+				Chunk:   res.Index,
+				Chapter: res.Chapter,
+				Pages:   paragraphRanges[i],
+				Text:    paragraph,
+			})
+		}
+	}
+
+	if job.Mode == combiner.ModeFlashcards {
+		resp.Flashcards = combiner.ParseFlashcards(parts)
+	}
+	return resp
+}
+
+// wantsJSON reports whether the client asked for the JSON response, either
+// with format=json or an Accept header that prefers application/json over
+// the mode's native content type.
+func wantsJSON(r *http.Request, mode combiner.Mode) bool {
+	if format := r.FormValue("format"); format != "" {
+		return strings.EqualFold(format, "json")
+	}
+
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return false
+	}
+
+	native, _, _ := mime.ParseMediaType(mode.ContentType())
+	nativeType, _, _ := strings.Cut(native, "/")
+	jsonQ, nativeQ := -1.0, -1.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if qStr, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(qStr, 64); err == nil {
+				q = parsed
+			}
+		}
+
+		switch mediaType {
+		case "application/json":
+			jsonQ = max(jsonQ, q)
+		case native, nativeType + "/*", "*/*":
+			nativeQ = max(nativeQ, q)
+		}
+	}
+	return jsonQ > 0 && jsonQ > nativeQ
+}
+
+// writeChapterArchive sends one file per chapter in a zip archive.
+func writeChapterArchive(w http.ResponseWriter, name string, mode combiner.Mode, overlap int, chapters []chunker.Chapter, sections []combiner.Section) error {
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", "attachment; filename="+name)
+
+	ext := path.Ext(mode.Filename())
+	archive := zip.NewWriter(w)
+	for i, chapter := range chapters {
+		name := chapter.Title
+		if name == "" {
+			name = "front-matter"
+		}
+		filename := fmt.Sprintf("%02d-%s%s", chapter.Index+1, strings.Trim(utils.SafeName(name), "-"), ext)
+
+		f, err := archive.Create(filename)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, combiner.Combine(mode, sections[i:i+1], overlap)); err != nil {
+			return err
+		}
+		log.Printf("Added %s to chapter archive", filename)
+	}
+	return archive.Close()
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to encode JSON response: %v", err)
+	}
+}
+
+type chunkOptionsResponse struct {
+	ChunkSize   int              `json:"chunk_size"`
+	ChunkTokens int              `json:"chunk_tokens"`
+	Strategy    chunker.Strategy `json:"strategy"`
+	Overlap     int              `json:"overlap"`
+	Markdown    bool             `json:"markdown"`
+}
+
+type sourceOffsets struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+type previewChunkResponse struct {
+	Index     int           `json:"index"`
+	Chapter   int           `json:"chapter"`
+	Text      string        `json:"text"`
+	Context   string        `json:"context,omitempty"`
+	Verbatim  []string      `json:"verbatim,omitempty"`
+	Sentences int           `json:"sentences"`
+	Words     int           `json:"words"`
+	Tokens    int           `json:"tokens"`
+	Source    sourceOffsets `json:"source"`
+	Pages     *pageRange    `json:"pages,omitempty"`
+}
+
+type previewChapterResponse struct {
+	Index  int        `json:"index"`
+	Title  string     `json:"title"`
+	Pages  *pageRange `json:"pages,omitempty"`
+	Chunks []int      `json:"chunks"`
+}
+
+type previewTotalsResponse struct {
+	Chunks    int `json:"chunks"`
+	Sentences int `json:"sentences"`
+	Words     int `json:"words"`
+	Tokens    int `json:"tokens"`
+}
+
+// outlineEntry is a PDF bookmark, numbered as the sections field selects
+// them.
+type outlineEntry struct {
+	Index int    `json:"index"`
+	Title string `json:"title"`
+	Level int    `json:"level"`
+	Page  int    `json:"page,omitempty"`
+}
+
+type chunksResponse struct {
+	Job      jobMetadata              `json:"job"`
+	Options  chunkOptionsResponse     `json:"options"`
+	Outline  []outlineEntry           `json:"outline,omitempty"`
+	Chapters []previewChapterResponse `json:"chapters"`
+	Chunks   []previewChunkResponse   `json:"chunks"`
+	Totals   previewTotalsResponse    `json:"totals"`
+}
+
+func newChunksResponse(job jobMetadata, opts chunker.Options, outline []pdf.Section, chapters []chunker.Chapter, chunks []chunker.Chunk, pages pageLookup) chunksResponse {
+	resp := chunksResponse{
+		Job: job,
+		Options: chunkOptionsResponse{
+			ChunkSize:   opts.ChunkSize,
+			ChunkTokens: opts.ChunkTokens,
+			Strategy:    opts.Strategy,
+			Overlap:     opts.Overlap,
+			Markdown:    opts.Markdown,
+		},
+		Chapters: make([]previewChapterResponse, 0, len(chapters)),
+		Chunks:   make([]previewChunkResponse, 0, len(chunks)),
+	}
+
+	for i, section := range outline {
+		resp.Outline = append(resp.Outline, outlineEntry{Index: i + 1, Title: section.Title, Level: section.Level, Page: section.Page})
+	}
+
+	for _, chapter := range chapters {
+		ch := previewChapterResponse{Index: chapter.Index, Title: chapter.Title, Chunks: []int{}}
+		for i, c := range chunks {
+			if c.Chapter == chapter.Index {
+				ch.Chunks = append(ch.Chunks, i)
+				ch.Pages = ch.Pages.span(pages(c.Start, c.End))
+			}
+		}
+		resp.Chapters = append(resp.Chapters, ch)
+	}
+
+	for i, c := range chunks {
+		resp.Chunks = append(resp.Chunks, previewChunkResponse{
+			Index:     i,
+			Chapter:   c.Chapter,
+			Text:      c.Text,
+			Context:   c.Context,
+			Verbatim:  c.Verbatim,
+			Sentences: c.Sentences,
+			Words:     c.Words,
+			Tokens:    c.Tokens,
+			Source:    sourceOffsets{Start: c.Start, End: c.End},
+			Pages:     pages(c.Start, c.End),
+		})
+		resp.Totals.Chunks++
+		resp.Totals.Sentences += c.Sentences
+		resp.Totals.Words += c.Words
+		resp.Totals.Tokens += c.Tokens
+	}
+	return resp
+}
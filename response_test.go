@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParagraphPages(t *testing.T) {
+	source := []string{
+		"The harbour froze early that winter and the fishermen stayed ashore.",
+		"Prices for bread climbed week after week until the council intervened.",
+		"In spring the council opened granaries and the harbour thawed.",
+		"Ships returned with grain from the southern provinces.",
+	}
+	text := strings.Join(source, "\n\n")
+	// Each source paragraph is on a page of its own.
+	pages := func(start, end int) *pageRange {
+		var r *pageRange
+		offset := 0
+		for i, p := range source {
+			length := len([]rune(p))
+			if offset < max(end, start+1) && offset+length > start {
+				r = r.span(&pageRange{First: i + 1, Last: i + 1})
+			}
+			offset += length + 2
+		}
+		return r
+	}
+
+	tests := []struct {
+		name    string
+		outputs []string
+		want    []pageRange
+	}{
+		{
+			name:    "one paragraph each",
+			outputs: []string{"The harbour froze and fishermen stayed ashore.", "Bread prices climbed until the council intervened.", "The council opened granaries in spring.", "Ships returned with grain."},
+			want:    []pageRange{{1, 1}, {2, 2}, {3, 3}, {4, 4}},
+		},
+		{
+			name:    "condensed paragraphs",
+			outputs: []string{"Bread prices climbed while the harbour was frozen and the council intervened.", "Ships returned with grain from the southern provinces."},
+			want:    []pageRange{{1, 2}, {3, 4}},
+		},
+		{
+			name:    "translated",
+			outputs: []string{"Le port a gelé.", "Le pain a coûté cher.", "Les navires sont revenus."},
+			want:    []pageRange{{1, 1}, {2, 2}, {3, 4}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := paragraphPages([]rune(text), 0, len([]rune(text)), tt.outputs, pages)
+			for i, r := range got {
+				if r == nil || *r != tt.want[i] {
+					t.Errorf("paragraph %d: pages %v, want %v", i, r, tt.want[i])
+				}
+			}
+		})
+	}
+}